@@ -1,17 +1,20 @@
 package lorca
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
+	"log/slog"
+	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/websocket"
 )
@@ -20,12 +23,28 @@ type h = map[string]interface{}
 
 // Result is a struct for the resulting value of the JS expression or an error.
 type result struct {
-	Value json.RawMessage
-	Err   error
+	Value  json.RawMessage
+	Err    error
+	Remote *remoteObject
+}
+
+// remoteObject is a mirror of a JS value returned by Runtime.evaluate
+type remoteObject struct {
+	Type                string          `json:"type"`
+	Subtype             string          `json:"subtype"`
+	Description         string          `json:"description"`
+	Value               json.RawMessage `json:"value"`
+	UnserializableValue string          `json:"unserializableValue"`
+	DeepSerializedValue *deepValue      `json:"deepSerializedValue"`
+	ObjectID            string          `json:"objectId"`
 }
 
 type bindingFunc func(args []json.RawMessage) (interface{}, error)
 
+// eventHandler is called from the read loop for every matching CDP event, so
+// it must not block or send commands synchronously.
+type eventHandler func(params json.RawMessage)
+
 // Msg is a struct for incoming messages (results and async events)
 type msg struct {
 	ID     int             `json:"id"`
@@ -37,63 +56,252 @@ type msg struct {
 
 type chrome struct {
 	sync.Mutex
-	cmd      *exec.Cmd
-	ws       *websocket.Conn
-	id       int32
-	target   string
-	session  string
-	window   int
-	pending  map[int]chan result
-	bindings map[string]bindingFunc
+	cmd                *exec.Cmd
+	killProcess        func() error
+	exited             chan struct{}
+	closing            bool
+	closeTimeout       time.Duration
+	startTimeout       time.Duration
+	stderr             *stderrLog
+	log                *slog.Logger
+	logConsole         bool
+	tracer             *tracer
+	discovery          Discovery
+	endpoint           Endpoint
+	done               chan struct{}
+	exitReason         ExitReason
+	exitCause          error
+	exitErr            *ExitError
+	supervisor         *Supervisor
+	restarts           int
+	url                string
+	conn               transport
+	record             *recordWriter
+	id                 int32
+	target             string
+	session            string
+	window             int
+	pending            map[int]chan result
+	bindings           map[string]bindingFunc
+	handlers           map[string][]eventHandler
+	worlds             map[string]*world
+	scripts            []*initScript
+	routes             []fetchRoute
+	served             []string
+	streamResponses    bool
+	relay              *streamRelay
+	auth               func(AuthChallenge) (string, string, bool)
+	policy             *NetworkPolicy
+	fetchEnabled       bool
+	har                *harRecorder
+	harEnabled         bool
+	download           func(d *Download)
+	downloadDir        string
+	saving             sync.WaitGroup // accepted downloads being moved
+	closers            []func()
+	fileChooser        func(FileChooserRequest) ([]string, error)
+	fileChooserEnabled bool
+	jsDialog           func(JSDialog) (bool, string)
+	jsDialogEnabled    bool
+	headless           bool
+	windowEvent        []func(WindowEvent)
+	windowEventMu      sync.Mutex
+	windowEventScript  bool
+	lastBounds         Bounds
+	scriptID           int32
+	noDeep             int32
 }
 
 func newChromeWithArgs(chromeBinary string, args ...string) (*chrome, error) {
+	return newChrome(exec.Command(chromeBinary, args...), Options{})
+}
+
+// newChrome starts the browser command, which must have remote debugging
+// enabled, and connects to it. Only the options that control the browser
+// process are used.
+func newChrome(cmd *exec.Cmd, o Options) (*chrome, error) {
+	c := newChromeState(o)
+	c.headless = isHeadless(cmd.Args)
+	if err := c.start(cmd); err != nil {
+		return nil, err
+	}
+	c.init()
+	return c, nil
+}
+
+// newChromeState returns a browser that is not started yet.
+func newChromeState(o Options) *chrome {
 	// The first two IDs are used internally during the initialization
 	c := &chrome{
 		id:       2,
 		pending:  map[int]chan result{},
 		bindings: map[string]bindingFunc{},
+		handlers: map[string][]eventHandler{},
+		worlds:   map[string]*world{},
+		done:     make(chan struct{}),
+
+		closeTimeout: defaultCloseTimeout,
+		startTimeout: defaultStartTimeout,
+		discovery:    o.Discovery,
+		record:       newRecordWriter(o.Record),
+
+		streamResponses: o.StreamRelay,
+	}
+	c.log, c.logConsole = o.Logger, o.Logger != nil
+	if c.log == nil {
+		c.log = slog.Default()
+	}
+	c.stderr = &stderrLog{out: o.Stderr, log: c.log}
+	c.tracer = newTracer(o.Trace, c.log)
+	if o.CloseTimeout > 0 {
+		c.closeTimeout = o.CloseTimeout
 	}
+	if o.StartTimeout > 0 {
+		c.startTimeout = o.StartTimeout
+	}
+	return c
+}
 
-	// Start chrome process
-	c.cmd = exec.Command(chromeBinary, args...)
-	pipe, err := c.cmd.StderrPipe()
+// init sets up the handlers of a connected browser.
+func (c *chrome) init() {
+	if c.headless {
+		// Headless browser can't show dialogs and would block the page forever
+		c.onJavaScriptDialog(nil)
+	}
+	c.on("Inspector.targetCrashed", func(json.RawMessage) { go c.crashed() })
+	c.trackURL()
+	go c.wait()
+}
+
+// start starts the browser process, connects to its page target and enables
+// the CDP domains used by Lorca.
+func (c *chrome) start(cmd *exec.Cmd) error {
+	// Start chrome process. Stderr is not a pipe from cmd.StderrPipe, because
+	// cmd.Wait would close it before all the output is read.
+	pr, pw, err := os.Pipe()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if err := c.cmd.Start(); err != nil {
-		return nil, err
+	cmd.Stderr = pw
+	portFile, portFileErr := "", error(nil)
+	if c.discovery != DiscoveryStderr {
+		portFile = activePortFile(cmd.Args)
+		if portFile == "" && c.discovery == DiscoveryActivePort {
+			pw.Close()
+			pr.Close()
+			return errors.New("DevToolsActivePort discovery requires a user profile directory")
+		}
+		if err := os.Remove(portFile); err != nil && !os.IsNotExist(err) {
+			// Stale file can't be told apart from the new one
+			c.log.Warn("can't remove stale DevToolsActivePort file", "error", err)
+			portFile, portFileErr = "", err
+		}
+	}
+	kill, err := startProcess(cmd)
+	pw.Close()
+	if err != nil {
+		pr.Close()
+		return err
 	}
+	var waitErr error
+	exited := make(chan struct{})
+	go func() {
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+	c.Lock()
+	c.cmd, c.killProcess, c.exited, c.closing = cmd, onceErr(kill), exited, false
+	c.Unlock()
 
-	// Wait for websocket address to be printed to stderr
+	// Wait for websocket address to be printed to stderr, or to be written
+	// into the DevToolsActivePort file, whichever comes first
 	re := regexp.MustCompile(`^DevTools listening on (ws://.*?)\r?\n$`)
-	m, err := readUntilMatch(pipe, re)
-	if err != nil {
+	match, eof := c.stderr.read(pr, re)
+	if c.discovery == DiscoveryActivePort {
+		match = nil
+	}
+	var activePort <-chan string
+	if portFile != "" {
+		stop := make(chan struct{})
+		defer close(stop)
+		activePort = watchActivePort(portFile, stop)
+	}
+	timeout := time.NewTimer(c.startTimeout)
+	defer timeout.Stop()
+	endpoint := Endpoint{}
+	select {
+	case m := <-match:
+		endpoint = Endpoint{URL: m[1], Discovery: DiscoveryStderr}
+	case url := <-activePort:
+		endpoint = Endpoint{URL: url, Discovery: DiscoveryActivePort}
+	case <-exited:
+		// Helper processes may keep stderr open, don't wait for them too long
+		select {
+		case <-eof:
+		case <-time.After(time.Second):
+		}
+		e := &StartError{ExitCode: cmd.ProcessState.ExitCode(), Stderr: c.stderr.tail(), PortFileErr: portFileErr, Err: waitErr}
+		if e.Err == nil {
+			e.Err = errors.New("browser exited")
+		}
 		c.kill()
-		return nil, err
+		return e
+	case <-timeout.C:
+		c.kill()
+		methods, names := []Discovery{}, []string{}
+		if match != nil {
+			methods = append(methods, DiscoveryStderr)
+		}
+		if activePort != nil {
+			methods = append(methods, DiscoveryActivePort)
+		}
+		for _, m := range methods {
+			names = append(names, string(m))
+		}
+		err := fmt.Errorf("%w, no DevTools endpoint found via %s", ErrStartTimeout, strings.Join(names, " or "))
+		return &StartError{ExitCode: -1, Stderr: c.stderr.tail(), Discovery: methods, PortFileErr: portFileErr, Err: err}
 	}
-	wsURL := m[1]
 
 	// Open a websocket
-	c.ws, err = websocket.Dial(wsURL, "", "http://127.0.0.1")
+	ws, err := websocket.Dial(endpoint.URL, "", "http://127.0.0.1")
 	if err != nil {
 		c.kill()
-		return nil, err
+		return err
+	}
+	c.Lock()
+	c.endpoint = endpoint
+	c.Unlock()
+	c.log.Debug("connected to browser", "url", endpoint.URL, "discovery", endpoint.Discovery)
+	var conn transport = &wsTransport{ws}
+	if c.record != nil {
+		conn = newRecorder(conn, c.record, c.headless)
 	}
+	return c.connect(conn)
+}
+
+// connect attaches to the page target and enables the CDP domains used by
+// Lorca.
+func (c *chrome) connect(conn transport) error {
+	c.Lock()
+	c.conn = conn
+	c.Unlock()
 
 	// Find target and initialize session
-	c.target, err = c.findTarget()
+	target, err := c.findTarget()
 	if err != nil {
 		c.kill()
-		return nil, err
+		return err
 	}
 
-	c.session, err = c.startSession(c.target)
+	session, err := c.startSession(target)
 	if err != nil {
 		c.kill()
-		return nil, err
+		return err
 	}
-	go c.readLoop()
+	c.Lock()
+	c.target, c.session = target, session
+	c.Unlock()
+	go c.readLoop(conn)
 	for method, args := range map[string]h{
 		"Page.enable":          nil,
 		"Target.setAutoAttach": {"autoAttach": true, "waitForDebuggerOnStart": false},
@@ -102,38 +310,55 @@ func newChromeWithArgs(chromeBinary string, args ...string) (*chrome, error) {
 		"Security.enable":      nil,
 		"Performance.enable":   nil,
 		"Log.enable":           nil,
+		"Inspector.enable":     nil,
 	} {
 		if _, err := c.send(method, args); err != nil {
 			c.kill()
-			c.cmd.Wait()
-			return nil, err
+			return err
 		}
 	}
 
-	if !contains(args, "--headless") {
-		win, err := c.getWindowForTarget(c.target)
+	if !c.headless {
+		win, err := c.getWindowForTarget(target)
 		if err != nil {
 			c.kill()
-			return nil, err
+			return err
 		}
+		c.Lock()
 		c.window = win.WindowID
+		c.Unlock()
 	}
 
-	return c, nil
+	return nil
+}
+
+// targetID returns the ID of the page target, which changes when the browser
+// is restarted.
+func (c *chrome) targetID() string {
+	c.Lock()
+	defer c.Unlock()
+	return c.target
+}
+
+// windowID returns the ID of the browser window of the page target.
+func (c *chrome) windowID() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.window
 }
 
 func (c *chrome) findTarget() (string, error) {
-	err := websocket.JSON.Send(c.ws, h{
-		"id": 0, "method": "Target.setDiscoverTargets", "params": h{"discover": true},
-	})
+	err := c.sendBrowser(c.conn, 0, "Target.setDiscoverTargets", h{"discover": true})
 	if err != nil {
 		return "", err
 	}
 	for {
 		m := msg{}
-		if err = websocket.JSON.Receive(c.ws, &m); err != nil {
+		if err = receiveJSON(c.conn, &m); err != nil {
 			return "", err
-		} else if m.Method == "Target.targetCreated" {
+		}
+		c.traceBrowser(m)
+		if m.Method == "Target.targetCreated" {
 			target := struct {
 				TargetInfo struct {
 					Type string `json:"type"`
@@ -150,17 +375,17 @@ func (c *chrome) findTarget() (string, error) {
 }
 
 func (c *chrome) startSession(target string) (string, error) {
-	err := websocket.JSON.Send(c.ws, h{
-		"id": 1, "method": "Target.attachToTarget", "params": h{"targetId": target},
-	})
+	err := c.sendBrowser(c.conn, 1, "Target.attachToTarget", h{"targetId": target})
 	if err != nil {
 		return "", err
 	}
 	for {
 		m := msg{}
-		if err = websocket.JSON.Receive(c.ws, &m); err != nil {
+		if err = receiveJSON(c.conn, &m); err != nil {
 			return "", err
-		} else if m.ID == 1 {
+		}
+		c.traceBrowser(m)
+		if m.ID == 1 {
 			if m.Error != nil {
 				return "", errors.New("Target error: " + string(m.Error))
 			}
@@ -175,6 +400,34 @@ func (c *chrome) startSession(target string) (string, error) {
 	}
 }
 
+// sendBrowser sends a command to the browser itself, outside of the page
+// session.
+func (c *chrome) sendBrowser(conn transport, id int, method string, params h) error {
+	c.tracer.command(id, "", method, params)
+	m := h{"id": id, "method": method}
+	if params != nil {
+		m["params"] = params
+	}
+	return sendJSON(conn, m)
+}
+
+// traceBrowser traces a response or an event received from the browser
+// itself, outside of the page session.
+func (c *chrome) traceBrowser(m msg) {
+	if c.tracer == nil {
+		return
+	}
+	if m.Method != "" {
+		c.tracer.event("", m.Method, m.Params)
+		return
+	}
+	e := struct {
+		Message string `json:"message"`
+	}{}
+	json.Unmarshal(m.Error, &e)
+	c.tracer.response(m.ID, "", m.Result, e.Message)
+}
+
 // WindowState defines the state of the Chrome window, possible values are
 // "normal", "maximized", "minimized" and "fullscreen".
 type WindowState string
@@ -235,13 +488,7 @@ type targetMessageTemplate struct {
 type targetMessage struct {
 	targetMessageTemplate
 	Result struct {
-		Result struct {
-			Type        string          `json:"type"`
-			Subtype     string          `json:"subtype"`
-			Description string          `json:"description"`
-			Value       json.RawMessage `json:"value"`
-			ObjectID    string          `json:"objectId"`
-		} `json:"result"`
+		Result    remoteObject `json:"result"`
 		Exception struct {
 			Exception struct {
 				Value json.RawMessage `json:"value"`
@@ -250,10 +497,11 @@ type targetMessage struct {
 	} `json:"result"`
 }
 
-func (c *chrome) readLoop() {
+func (c *chrome) readLoop(conn transport) {
 	for {
 		m := msg{}
-		if err := websocket.JSON.Receive(c.ws, &m); err != nil {
+		if err := receiveJSON(conn, &m); err != nil {
+			c.disconnected(conn, err)
 			return
 		}
 
@@ -263,14 +511,28 @@ func (c *chrome) readLoop() {
 				Message   string `json:"message"`
 			}{}
 			json.Unmarshal(m.Params, &params)
-			if params.SessionID != c.session {
+			c.Lock()
+			session := c.session
+			c.Unlock()
+			if params.SessionID != session {
 				continue
 			}
 			res := targetMessage{}
 			json.Unmarshal([]byte(params.Message), &res)
 
+			if res.ID == 0 && res.Method != "" {
+				ev := msg{}
+				json.Unmarshal([]byte(params.Message), &ev)
+				c.tracer.event(params.SessionID, ev.Method, ev.Params)
+				c.dispatch(ev.Method, ev.Params)
+			} else if c.tracer != nil {
+				ev := msg{}
+				json.Unmarshal([]byte(params.Message), &ev)
+				c.tracer.response(ev.ID, params.SessionID, ev.Result, res.Error.Message)
+			}
+
 			if res.ID == 0 && res.Method == "Runtime.consoleAPICalled" || res.Method == "Runtime.exceptionThrown" {
-				log.Println(params.Message)
+				c.console(res.Method, []byte(params.Message))
 			} else if res.ID == 0 && res.Method == "Runtime.bindingCalled" {
 				payload := struct {
 					Name string            `json:"name"`
@@ -279,9 +541,7 @@ func (c *chrome) readLoop() {
 				}{}
 				json.Unmarshal([]byte(res.Params.Payload), &payload)
 
-				c.Lock()
-				binding, ok := c.bindings[res.Params.Name]
-				c.Unlock()
+				binding, ok := c.binding(res.Params.ID, res.Params.Name)
 				if ok {
 					jsString := func(v interface{}) string { b, _ := json.Marshal(v); return string(b) }
 					go func() {
@@ -324,45 +584,151 @@ func (c *chrome) readLoop() {
 			} else if res.Result.Result.Type == "object" && res.Result.Result.Subtype == "error" {
 				resc <- result{Err: errors.New(res.Result.Result.Description)}
 			} else if res.Result.Result.Type != "" {
-				resc <- result{Value: res.Result.Result.Value}
+				resc <- result{Value: res.Result.Result.Value, Remote: &res.Result.Result}
 			} else {
 				res := targetMessageTemplate{}
 				json.Unmarshal([]byte(params.Message), &res)
 				resc <- result{Value: res.Result}
 			}
-		} else if m.Method == "Target.targetDestroyed" {
+		} else if m.Method != "" {
+			c.tracer.event("", m.Method, m.Params)
+			c.dispatch(m.Method, m.Params)
+		} else {
+			c.traceBrowser(m)
+		}
+		if m.Method == "Target.targetDestroyed" {
 			params := struct {
 				TargetID string `json:"targetId"`
 			}{}
 			json.Unmarshal(m.Params, &params)
-			if params.TargetID == c.target {
-				c.kill()
+			if params.TargetID == c.targetID() {
+				// The window is closed, let the browser finish its shutdown
+				c.setExitReason(ExitWindowClosed, nil)
+				go c.close()
 				return
 			}
 		}
 	}
 }
 
+// console logs messages printed to the JS console and uncaught exceptions.
+// Without a logger they are printed by the standard log package as is.
+func (c *chrome) console(method string, message []byte) {
+	if !c.logConsole {
+		log.Println(string(message))
+		return
+	}
+	ev := struct {
+		Params struct {
+			Type string         `json:"type"`
+			Args []remoteObject `json:"args"`
+			// Exception details
+			Details struct {
+				Text      string       `json:"text"`
+				URL       string       `json:"url"`
+				Line      int          `json:"lineNumber"`
+				Exception remoteObject `json:"exception"`
+			} `json:"exceptionDetails"`
+		} `json:"params"`
+	}{}
+	json.Unmarshal(message, &ev)
+	p := ev.Params
+	if method == "Runtime.exceptionThrown" {
+		c.log.Error("uncaught exception", "text", p.Details.Text, "exception", p.Details.Exception.Description,
+			"url", p.Details.URL, "line", p.Details.Line)
+		return
+	}
+	args := []string{}
+	for _, arg := range p.Args {
+		var s string
+		if err := json.Unmarshal(arg.Value, &s); err == nil {
+			args = append(args, s)
+		} else if arg.Value != nil {
+			args = append(args, string(arg.Value))
+		} else if arg.UnserializableValue != "" {
+			args = append(args, arg.UnserializableValue)
+		} else {
+			args = append(args, arg.Description)
+		}
+	}
+	level := slog.LevelInfo
+	switch p.Type {
+	case "error", "assert":
+		level = slog.LevelError
+	case "warning":
+		level = slog.LevelWarn
+	case "debug":
+		level = slog.LevelDebug
+	}
+	c.log.Log(context.Background(), level, "console", "type", p.Type, "message", strings.Join(args, " "))
+}
+
+// on registers a handler for the CDP event with the given method name. Events
+// from both, the browser and the page session are delivered.
+func (c *chrome) on(method string, f eventHandler) {
+	c.Lock()
+	defer c.Unlock()
+	c.handlers[method] = append(c.handlers[method], f)
+}
+
+func (c *chrome) dispatch(method string, params json.RawMessage) {
+	c.Lock()
+	handlers := c.handlers[method]
+	c.Unlock()
+	for _, f := range handlers {
+		f(params)
+	}
+}
+
+// binding returns a binding function by its name, bindings of the isolated
+// worlds take precedence over the main world bindings.
+func (c *chrome) binding(context int, name string) (bindingFunc, bool) {
+	c.Lock()
+	defer c.Unlock()
+	for _, w := range c.worlds {
+		if w.context == context {
+			if f, ok := w.bindings[name]; ok {
+				return f, true
+			}
+		}
+	}
+	f, ok := c.bindings[name]
+	return f, ok
+}
+
 func (c *chrome) send(method string, params h) (json.RawMessage, error) {
+	res := c.call(method, params)
+	return res.Value, res.Err
+}
+
+func (c *chrome) call(method string, params h) result {
 	id := atomic.AddInt32(&c.id, 1)
 	b, err := json.Marshal(h{"id": int(id), "method": method, "params": params})
 	if err != nil {
-		return nil, err
+		return result{Err: err}
 	}
-	resc := make(chan result)
+	resc := make(chan result, 1)
 	c.Lock()
+	if c.exitErr != nil {
+		c.Unlock()
+		return result{Err: c.exitErr}
+	}
+	conn, session := c.conn, c.session
 	c.pending[int(id)] = resc
 	c.Unlock()
+	c.tracer.command(int(id), session, method, params)
 
-	if err := websocket.JSON.Send(c.ws, h{
+	if err := sendJSON(conn, h{
 		"id":     int(id),
 		"method": "Target.sendMessageToTarget",
-		"params": h{"message": string(b), "sessionId": c.session},
+		"params": h{"message": string(b), "sessionId": session},
 	}); err != nil {
-		return nil, err
+		c.Lock()
+		delete(c.pending, int(id))
+		c.Unlock()
+		return result{Err: err}
 	}
-	res := <-resc
-	return res.Value, res.Err
+	return <-resc
 }
 
 func (c *chrome) load(url string) error {
@@ -371,7 +737,60 @@ func (c *chrome) load(url string) error {
 }
 
 func (c *chrome) eval(expr string) (json.RawMessage, error) {
-	return c.send("Runtime.evaluate", h{"expression": expr, "awaitPromise": true, "returnByValue": true})
+	v := c.evalValue(expr)
+	return v.raw, v.err
+}
+
+func (c *chrome) evalValue(expr string) value {
+	return c.evaluate(h{"expression": expr, "awaitPromise": true})
+}
+
+// evaluate runs Runtime.evaluate with the given params. Deep serialization is
+// preferred, so that values like undefined, NaN, BigInt or Date are not lost.
+// It's turned off once the browser version is known to be too old, otherwise
+// a result without a deep serialized value returns a reference to the remote
+// object, which is then converted into JSON without evaluating the expression
+// again.
+func (c *chrome) evaluate(params h) value {
+	deep := atomic.LoadInt32(&c.noDeep) == 0
+	if deep {
+		params["serializationOptions"] = h{"serialization": "deep"}
+	} else {
+		params["returnByValue"] = true
+	}
+	res := c.call("Runtime.evaluate", params)
+	if res.Err != nil || res.Remote == nil {
+		return value{err: res.Err, raw: res.Value}
+	}
+	r := res.Remote
+	if r.ObjectID != "" {
+		defer func() { go c.send("Runtime.releaseObject", h{"objectId": r.ObjectID}) }()
+		if deep && r.DeepSerializedValue == nil {
+			v, err := c.send("Runtime.callFunctionOn", h{
+				"objectId":            r.ObjectID,
+				"functionDeclaration": "function() { return this; }",
+				"returnByValue":       true,
+			})
+			return value{err: err, raw: v}
+		}
+	}
+	return remoteValue(r)
+}
+
+// remoteValue converts a remote object into a value, preserving the values
+// that can't be represented in JSON.
+func remoteValue(r *remoteObject) value {
+	if r.DeepSerializedValue != nil {
+		return r.DeepSerializedValue.value()
+	}
+	if r.Type == "undefined" {
+		return (&deepValue{Type: "undefined"}).value()
+	}
+	if s := r.UnserializableValue; s != "" {
+		d := &deepValue{Type: r.Type, Value: json.RawMessage(strconv.Quote(strings.TrimSuffix(s, "n")))}
+		return d.value()
+	}
+	return value{raw: r.Value}
 }
 
 func (c *chrome) bind(name string, f bindingFunc) error {
@@ -391,7 +810,19 @@ func (c *chrome) bind(name string, f bindingFunc) error {
 	if _, err := c.send("Runtime.addBinding", h{"name": name}); err != nil {
 		return err
 	}
-	script := fmt.Sprintf(`(() => {
+	script := bindingScript(name)
+	_, err := c.send("Page.addScriptToEvaluateOnNewDocument", h{"source": script})
+	if err != nil {
+		return err
+	}
+	_, err = c.eval(script)
+	return err
+}
+
+// bindingScript returns JS code that wraps a CDP binding into a function that
+// returns a promise, resolved once the Go function returns.
+func bindingScript(name string) string {
+	return fmt.Sprintf(`(() => {
 	const bindingName = '%s';
 	const binding = window[bindingName];
 	window[bindingName] = async (...args) => {
@@ -416,28 +847,46 @@ func (c *chrome) bind(name string, f bindingFunc) error {
 		return promise;
 	}})();
 	`, name)
-	_, err := c.send("Page.addScriptToEvaluateOnNewDocument", h{"source": script})
-	if err != nil {
-		return err
-	}
-	_, err = c.eval(script)
-	return err
 }
 
+// setBounds changes window position, size and state. Chrome ignores position
+// and size unless the window is in the normal state, so if both are given the
+// window is restored first, then resized, and then the new state is applied.
+// This way maximized window can be restored to the given size in one call.
 func (c *chrome) setBounds(b Bounds) error {
 	if b.WindowState == "" {
 		b.WindowState = WindowStateNormal
 	}
-	param := h{"windowId": c.window, "bounds": b}
-	if b.WindowState != WindowStateNormal {
-		param["bounds"] = h{"windowState": b.WindowState}
+	if b.WindowState != WindowStateNormal && b.Width == 0 && b.Height == 0 {
+		return c.setWindowState(b.WindowState)
 	}
-	_, err := c.send("Browser.setWindowBounds", param)
+	current, err := c.bounds()
+	if err != nil {
+		return err
+	}
+	if current.WindowState != WindowStateNormal {
+		if err := c.setWindowState(WindowStateNormal); err != nil {
+			return err
+		}
+	}
+	state := b.WindowState
+	b.WindowState = WindowStateNormal
+	if _, err := c.send("Browser.setWindowBounds", h{"windowId": c.windowID(), "bounds": b}); err != nil {
+		return err
+	}
+	if state != WindowStateNormal {
+		return c.setWindowState(state)
+	}
+	return nil
+}
+
+func (c *chrome) setWindowState(state WindowState) error {
+	_, err := c.send("Browser.setWindowBounds", h{"windowId": c.windowID(), "bounds": h{"windowState": state}})
 	return err
 }
 
 func (c *chrome) bounds() (Bounds, error) {
-	result, err := c.send("Browser.getWindowBounds", h{"windowId": c.window})
+	result, err := c.send("Browser.getWindowBounds", h{"windowId": c.windowID()})
 	if err != nil {
 		return Bounds{}, err
 	}
@@ -503,35 +952,70 @@ func (c *chrome) png(x, y, width, height int, bg uint32, scale float32) ([]byte,
 	return pdf.Data, err
 }
 
-func (c *chrome) kill() error {
-	if c.ws != nil {
-		if err := c.ws.Close(); err != nil {
-			return err
+// defaultCloseTimeout is how long the browser may take to exit gracefully.
+const defaultCloseTimeout = 5 * time.Second
+
+// close asks the browser to exit, so that it can flush the profile to disk,
+// and kills it if it doesn't exit in time.
+func (c *chrome) close() error {
+	c.Lock()
+	conn, exited, closing := c.conn, c.exited, c.closing
+	c.closing = true
+	c.Unlock()
+	if closing {
+		// Already closing, e.g. the window has been closed by the user
+		<-exited
+		return nil
+	}
+	if conn != nil {
+		id := atomic.AddInt32(&c.id, 1)
+		if err := c.sendBrowser(conn, int(id), "Browser.close", nil); err == nil {
+			t := time.NewTimer(c.closeTimeout)
+			defer t.Stop()
+			select {
+			case <-exited:
+			case <-t.C:
+				c.log.Warn("browser did not exit in time, killing it", "timeout", c.closeTimeout)
+			}
 		}
 	}
-	// TODO: cancel all pending requests
-	if state := c.cmd.ProcessState; state == nil || !state.Exited() {
-		return c.cmd.Process.Kill()
+	return c.kill()
+}
+
+// kill kills the browser with all its child processes and waits until it
+// exits.
+func (c *chrome) kill() error {
+	c.Lock()
+	conn, kill, exited := c.conn, c.killProcess, c.exited
+	c.Unlock()
+	if conn != nil {
+		conn.Close()
 	}
-	return nil
+	var err error
+	select {
+	case <-exited:
+		// Kill the remaining helper processes, if any
+		kill()
+	default:
+		err = kill()
+	}
+	<-exited
+	return err
 }
 
-func readUntilMatch(r io.ReadCloser, re *regexp.Regexp) ([]string, error) {
-	br := bufio.NewReader(r)
-	for {
-		if line, err := br.ReadString('\n'); err != nil {
-			r.Close()
-			return nil, err
-		} else if m := re.FindStringSubmatch(line); m != nil {
-			go io.Copy(ioutil.Discard, br)
-			return m, nil
-		}
+// onceErr returns a function that calls f only once and then returns the
+// same error, so that the process is never killed twice.
+func onceErr(f func() error) func() error {
+	once, err := sync.Once{}, error(nil)
+	return func() error {
+		once.Do(func() { err = f() })
+		return err
 	}
 }
 
-func contains(arr []string, x string) bool {
-	for _, n := range arr {
-		if x == n {
+func isHeadless(args []string) bool {
+	for _, arg := range args {
+		if arg == "--headless" || strings.HasPrefix(arg, "--headless=") {
 			return true
 		}
 	}
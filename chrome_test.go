@@ -1,8 +1,12 @@
 package lorca
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"log"
+	"log/slog"
+	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -140,3 +144,23 @@ func TestChromeAsync(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestChromeConsole(t *testing.T) {
+	message := `{"method":"Runtime.consoleAPICalled","params":{"type":"debug","args":[{"type":"string","value":"hello"}]}}`
+
+	// Without a logger messages are printed as is, at any level
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+	newChromeState(Options{}).console("Runtime.consoleAPICalled", []byte(message))
+	if !strings.Contains(buf.String(), message) {
+		t.Fatal(buf.String())
+	}
+
+	buf.Reset()
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	newChromeState(Options{Logger: logger}).console("Runtime.consoleAPICalled", []byte(message))
+	if s := buf.String(); !strings.Contains(s, "level=DEBUG") || !strings.Contains(s, "message=hello") {
+		t.Fatal(s)
+	}
+}
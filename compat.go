@@ -0,0 +1,98 @@
+package lorca
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// MinChromeVersion is the oldest major browser version New accepts. A higher
+// minimum can be set with Options.Policy.
+var MinChromeVersion = 70
+
+// ErrUnsupportedBrowser is returned when the browser is too old.
+var ErrUnsupportedBrowser = errors.New("unsupported browser")
+
+// Version describes the running browser.
+type Version struct {
+	// Product is the browser name and version, e.g. "Chrome/120.0.6099.109".
+	Product         string `json:"product"`
+	Revision        string `json:"revision"`
+	ProtocolVersion string `json:"protocolVersion"`
+	UserAgent       string `json:"userAgent"`
+	JSVersion       string `json:"jsVersion"`
+}
+
+// Major returns the major browser version, or zero if it's unknown.
+func (v Version) Major() int {
+	i := strings.LastIndex(v.Product, "/")
+	major, _ := strconv.Atoi(strings.SplitN(v.Product[i+1:], ".", 2)[0])
+	return major
+}
+
+// Unsupported returns the Lorca features that don't work, or only partially
+// work, in this browser version.
+func (v Version) Unsupported() []string {
+	features := []string{}
+	major := v.Major()
+	if major == 0 {
+		return features
+	}
+	for _, c := range compatibility {
+		if major < c.Since {
+			features = append(features, c.Feature)
+		}
+	}
+	return features
+}
+
+// compatibility lists Lorca features that require a browser newer than
+// MinChromeVersion.
+var compatibility = []struct {
+	Since   int
+	Feature string
+}{
+	{74, "request interception, Intercept, Handle and ServeFS"},
+	{77, "file chooser interception, OnFileChooser"},
+	{90, "download handling, OnDownload"},
+	{100, "screen enumeration, Screens only returns the current screen"},
+	{deepSerializationSince, "deep serialization, Eval converts undefined, NaN, BigInt and Date through JSON"},
+}
+
+// deepSerializationSince is the first major browser version that supports
+// deep serialization of Runtime.evaluate results.
+const deepSerializationSince = 117
+
+func (c *chrome) version() (Version, error) {
+	v := Version{}
+	res, err := c.send("Browser.getVersion", nil)
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(res, &v)
+	return v, err
+}
+
+// checkVersion returns an error if the browser is older than the minimum
+// major version. Browsers that report no version are accepted. It also turns
+// off deep serialization for browsers that don't support it.
+func (c *chrome) checkVersion(min int) error {
+	if min < MinChromeVersion {
+		min = MinChromeVersion
+	}
+	v, err := c.version()
+	if err != nil {
+		return err
+	}
+	major := v.Major()
+	if major > 0 && major < deepSerializationSince {
+		atomic.StoreInt32(&c.noDeep, 1)
+	}
+	if major > 0 && major < min {
+		return fmt.Errorf("%w: %s is too old, version %d or newer is required", ErrUnsupportedBrowser, v.Product, min)
+	}
+	return nil
+}
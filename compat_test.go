@@ -0,0 +1,39 @@
+package lorca
+
+import "testing"
+
+func TestVersionUnsupported(t *testing.T) {
+	for _, test := range []struct {
+		Product     string
+		Major       int
+		Unsupported int
+	}{
+		{"Chrome/120.0.6099.109", 120, 0},
+		{"HeadlessChrome/99.0.4844.51", 99, 2},
+		{"Chrome/73.0.3683.86", 73, len(compatibility)},
+		{"Unknown", 0, 0},
+	} {
+		v := Version{Product: test.Product}
+		if v.Major() != test.Major || len(v.Unsupported()) != test.Unsupported {
+			t.Error(test, v.Major(), v.Unsupported())
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+	v, err := ui.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Major() < MinChromeVersion || v.ProtocolVersion == "" || v.UserAgent == "" || v.JSVersion == "" {
+		t.Error(v)
+	}
+	if features := v.Unsupported(); len(features) > 0 {
+		t.Log(features)
+	}
+}
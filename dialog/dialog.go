@@ -0,0 +1,103 @@
+// Package dialog shows native OS dialogs: messages, confirmations, text input
+// and file choosers. It uses zenity or kdialog on Linux, osascript on macOS
+// and Win32 API on Windows.
+package dialog
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrUnsupported is returned if no dialog backend is available, e.g. neither
+// zenity nor kdialog is installed.
+var ErrUnsupported = errors.New("dialog: no dialog backend available")
+
+// Filter is a named group of file patterns, e.g. {"Images", []string{"*.png",
+// "*.jpg"}}.
+type Filter struct {
+	Name     string
+	Patterns []string
+}
+
+type kind int
+
+const (
+	kindInfo kind = iota
+	kindWarning
+	kindError
+	kindConfirm
+	kindInput
+	kindOpenFile
+	kindSaveFile
+	kindSelectDirectory
+)
+
+type request struct {
+	kind     kind
+	title    string
+	text     string
+	value    string
+	multiple bool
+	filters  []Filter
+}
+
+// Info shows an informational message.
+func Info(title, text string) error {
+	_, _, err := show(request{kind: kindInfo, title: title, text: text})
+	return err
+}
+
+// Warning shows a warning message.
+func Warning(title, text string) error {
+	_, _, err := show(request{kind: kindWarning, title: title, text: text})
+	return err
+}
+
+// Error shows an error message.
+func Error(title, text string) error {
+	_, _, err := show(request{kind: kindError, title: title, text: text})
+	return err
+}
+
+// Confirm asks a yes/no question and returns true if the user answered yes.
+func Confirm(title, text string) (bool, error) {
+	_, ok, err := show(request{kind: kindConfirm, title: title, text: text})
+	return ok, err
+}
+
+// Input asks the user to enter a line of text, value is the initial text. It
+// returns false if the dialog has been canceled.
+func Input(title, text, value string) (string, bool, error) {
+	return show(request{kind: kindInput, title: title, text: text, value: value})
+}
+
+// OpenFile asks the user to choose one or more existing files. It returns no
+// files if the dialog has been canceled.
+func OpenFile(title string, multiple bool, filters ...Filter) ([]string, error) {
+	out, ok, err := show(request{kind: kindOpenFile, title: title, multiple: multiple, filters: filters})
+	if !ok || err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, f := range strings.Split(out, "\n") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// SaveFile asks the user to choose a file name to save to, name is the
+// suggested file name. It returns an empty string if the dialog has been
+// canceled.
+func SaveFile(title, name string, filters ...Filter) (string, error) {
+	out, _, err := show(request{kind: kindSaveFile, title: title, value: name, filters: filters})
+	return out, err
+}
+
+// SelectDirectory asks the user to choose a directory. It returns an empty
+// string if the dialog has been canceled.
+func SelectDirectory(title string) (string, error) {
+	out, _, err := show(request{kind: kindSelectDirectory, title: title})
+	return out, err
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+// +build !windows
+
+package dialog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestZenityArgs(t *testing.T) {
+	for _, test := range []struct {
+		Request request
+		Args    []string
+	}{
+		{
+			Request: request{kind: kindConfirm, title: "Title", text: `<b>"quoted"</b>`},
+			Args:    []string{"--title", "Title", "--question", "--no-markup", "--text", `<b>"quoted"</b>`},
+		},
+		{
+			Request: request{kind: kindInput, title: "T", text: "Name?", value: "John"},
+			Args:    []string{"--title", "T", "--entry", "--text", "Name?", "--entry-text", "John"},
+		},
+		{
+			Request: request{kind: kindOpenFile, title: "T", multiple: true, filters: []Filter{{"Images", []string{"*.png", "*.jpg"}}}},
+			Args:    []string{"--title", "T", "--file-selection", "--separator", "\n", "--multiple", "--file-filter", "Images | *.png *.jpg"},
+		},
+	} {
+		if args := zenityArgs(test.Request); !reflect.DeepEqual(args, test.Args) {
+			t.Error(args, test.Args)
+		}
+	}
+}
+
+func TestKdialogArgs(t *testing.T) {
+	args := kdialogArgs(request{kind: kindOpenFile, title: "T", multiple: true, filters: []Filter{
+		{"Images", []string{"*.png", "*.jpg"}}, {"All", []string{"*"}},
+	}})
+	expected := []string{"--title", "T", "--multiple", "--separate-output", "--getopenfilename", ".", "*.png *.jpg|Images\n*|All"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatal(args)
+	}
+}
+
+func TestOsascriptArgs(t *testing.T) {
+	text := `He said "hi" \ left`
+	args := osascriptArgs(request{kind: kindConfirm, title: "T", text: text})
+	if n := len(args); n < 3 || args[n-3] != "--" || args[n-2] != text || args[n-1] != "T" {
+		t.Fatal(args)
+	}
+	if s := appleString(text); s != `"He said \"hi\" \\ left"` {
+		t.Fatal(s)
+	}
+	if s := appleTypes([]Filter{{"Images", []string{"*.png", `*.j"pg`}}}); s != ` of type {"png", "j\"pg"}` {
+		t.Fatal(s)
+	}
+	if s := appleTypes([]Filter{{"Images", []string{"*.png"}}, {"All", []string{"*"}}}); s != "" {
+		t.Fatal(s)
+	}
+}
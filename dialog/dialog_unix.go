@@ -0,0 +1,161 @@
+//go:build !windows
+// +build !windows
+
+package dialog
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+func show(r request) (string, bool, error) {
+	if runtime.GOOS == "darwin" {
+		return run("osascript", osascriptArgs(r))
+	}
+	if _, err := exec.LookPath("zenity"); err == nil {
+		return run("zenity", zenityArgs(r))
+	}
+	if _, err := exec.LookPath("kdialog"); err == nil {
+		return run("kdialog", kdialogArgs(r))
+	}
+	return "", false, ErrUnsupported
+}
+
+// run executes the dialog command and returns its output. All backends exit
+// with status 1 if the dialog is canceled or the answer is "no".
+func run(name string, args []string) (string, bool, error) {
+	out, err := exec.Command(name, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return strings.TrimRight(string(out), "\r\n"), true, nil
+}
+
+func zenityArgs(r request) []string {
+	args := []string{"--title", r.title}
+	switch r.kind {
+	case kindInfo:
+		args = append(args, "--info", "--no-markup", "--text", r.text)
+	case kindWarning:
+		args = append(args, "--warning", "--no-markup", "--text", r.text)
+	case kindError:
+		args = append(args, "--error", "--no-markup", "--text", r.text)
+	case kindConfirm:
+		args = append(args, "--question", "--no-markup", "--text", r.text)
+	case kindInput:
+		args = append(args, "--entry", "--text", r.text, "--entry-text", r.value)
+	case kindOpenFile:
+		args = append(args, "--file-selection", "--separator", "\n")
+		if r.multiple {
+			args = append(args, "--multiple")
+		}
+	case kindSaveFile:
+		args = append(args, "--file-selection", "--save", "--confirm-overwrite", "--filename", r.value)
+	case kindSelectDirectory:
+		args = append(args, "--file-selection", "--directory")
+	}
+	if r.kind == kindOpenFile || r.kind == kindSaveFile {
+		for _, f := range r.filters {
+			args = append(args, "--file-filter", f.Name+" | "+strings.Join(f.Patterns, " "))
+		}
+	}
+	return args
+}
+
+func kdialogArgs(r request) []string {
+	args := []string{"--title", r.title}
+	filter := []string{}
+	for _, f := range r.filters {
+		filter = append(filter, strings.Join(f.Patterns, " ")+"|"+f.Name)
+	}
+	switch r.kind {
+	case kindInfo:
+		args = append(args, "--msgbox", r.text)
+	case kindWarning:
+		args = append(args, "--sorry", r.text)
+	case kindError:
+		args = append(args, "--error", r.text)
+	case kindConfirm:
+		args = append(args, "--yesno", r.text)
+	case kindInput:
+		args = append(args, "--inputbox", r.text, r.value)
+	case kindOpenFile:
+		if r.multiple {
+			args = append(args, "--multiple", "--separate-output")
+		}
+		args = append(args, "--getopenfilename", ".", strings.Join(filter, "\n"))
+	case kindSaveFile:
+		args = append(args, "--getsavefilename", r.value, strings.Join(filter, "\n"))
+	case kindSelectDirectory:
+		args = append(args, "--getexistingdirectory")
+	}
+	return args
+}
+
+// osascriptArgs returns arguments for osascript. User-provided strings are
+// passed as script arguments and are never spliced into the script source,
+// only the file types are, after being quoted.
+func osascriptArgs(r request) []string {
+	var script string
+	argv := []string{r.text, r.title}
+	switch r.kind {
+	case kindInfo, kindWarning, kindError:
+		icon := map[kind]string{kindInfo: "note", kindWarning: "caution", kindError: "stop"}[r.kind]
+		script = `display dialog (item 1 of argv) with title (item 2 of argv) buttons {"OK"} default button "OK" with icon ` + icon
+	case kindConfirm:
+		script = `set answer to button returned of (display dialog (item 1 of argv) with title (item 2 of argv) buttons {"No", "Yes"} default button "Yes")
+if answer is not "Yes" then error number -128`
+	case kindInput:
+		argv = append(argv, r.value)
+		script = `text returned of (display dialog (item 1 of argv) with title (item 2 of argv) default answer (item 3 of argv))`
+	case kindOpenFile:
+		argv = []string{r.title}
+		choose := `choose file with prompt (item 1 of argv)` + appleTypes(r.filters)
+		if r.multiple {
+			script = `set out to ""
+repeat with f in (` + choose + ` with multiple selections allowed)
+	set out to out & POSIX path of f & linefeed
+end repeat
+out`
+		} else {
+			script = `POSIX path of (` + choose + `)`
+		}
+	case kindSaveFile:
+		argv = []string{r.title, r.value}
+		script = `POSIX path of (choose file name with prompt (item 1 of argv) default name (item 2 of argv))`
+	case kindSelectDirectory:
+		argv = []string{r.title}
+		script = `POSIX path of (choose folder with prompt (item 1 of argv))`
+	}
+	args := []string{"-e", "on run argv", "-e", script, "-e", "end run", "--"}
+	return append(args, argv...)
+}
+
+// appleTypes returns "of type" clause with file extensions from the filters.
+func appleTypes(filters []Filter) string {
+	types := []string{}
+	for _, f := range filters {
+		for _, p := range f.Patterns {
+			if ext := strings.TrimPrefix(p, "*."); ext != p && ext != "*" {
+				types = append(types, appleString(ext))
+			} else {
+				// Any file is accepted by one of the filters
+				return ""
+			}
+		}
+	}
+	if len(types) == 0 {
+		return ""
+	}
+	return " of type {" + strings.Join(types, ", ") + "}"
+}
+
+// appleString quotes a string as an AppleScript string literal.
+func appleString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,211 @@
+//go:build windows
+// +build windows
+
+package dialog
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	user32   = syscall.NewLazyDLL("user32.dll")
+	comdlg32 = syscall.NewLazyDLL("comdlg32.dll")
+	shell32  = syscall.NewLazyDLL("shell32.dll")
+	ole32    = syscall.NewLazyDLL("ole32.dll")
+
+	messageBoxW          = user32.NewProc("MessageBoxW")
+	getOpenFileNameW     = comdlg32.NewProc("GetOpenFileNameW")
+	getSaveFileNameW     = comdlg32.NewProc("GetSaveFileNameW")
+	shBrowseForFolderW   = shell32.NewProc("SHBrowseForFolderW")
+	shGetPathFromIDListW = shell32.NewProc("SHGetPathFromIDListW")
+	coInitializeEx       = ole32.NewProc("CoInitializeEx")
+	coTaskMemFree        = ole32.NewProc("CoTaskMemFree")
+)
+
+const (
+	mbOK              = 0x00000000
+	mbYesNo           = 0x00000004
+	mbIconError       = 0x00000010
+	mbIconQuestion    = 0x00000020
+	mbIconWarning     = 0x00000030
+	mbIconInformation = 0x00000040
+	idYes             = 6
+
+	ofnOverwritePrompt  = 0x00000002
+	ofnNoChangeDir      = 0x00000008
+	ofnAllowMultiSelect = 0x00000200
+	ofnPathMustExist    = 0x00000800
+	ofnFileMustExist    = 0x00001000
+	ofnExplorer         = 0x00080000
+
+	bifReturnOnlyFSDirs = 0x00000001
+	bifNewDialogStyle   = 0x00000040
+
+	coinitApartmentThreaded = 0x2
+)
+
+type openFileName struct {
+	structSize      uint32
+	owner           uintptr
+	instance        uintptr
+	filter          *uint16
+	customFilter    *uint16
+	maxCustomFilter uint32
+	filterIndex     uint32
+	file            *uint16
+	maxFile         uint32
+	fileTitle       *uint16
+	maxFileTitle    uint32
+	initialDir      *uint16
+	title           *uint16
+	flags           uint32
+	fileOffset      uint16
+	fileExtension   uint16
+	defExt          *uint16
+	custData        uintptr
+	fnHook          uintptr
+	templateName    *uint16
+	reserved        uintptr
+	reservedInt     uint32
+	flagsEx         uint32
+}
+
+type browseInfo struct {
+	owner       uintptr
+	root        uintptr
+	displayName *uint16
+	title       *uint16
+	flags       uint32
+	callback    uintptr
+	param       uintptr
+	image       int32
+}
+
+func show(r request) (string, bool, error) {
+	switch r.kind {
+	case kindInfo:
+		messageBox(r.title, r.text, mbOK|mbIconInformation)
+		return "", true, nil
+	case kindWarning:
+		messageBox(r.title, r.text, mbOK|mbIconWarning)
+		return "", true, nil
+	case kindError:
+		messageBox(r.title, r.text, mbOK|mbIconError)
+		return "", true, nil
+	case kindConfirm:
+		return "", messageBox(r.title, r.text, mbYesNo|mbIconQuestion) == idYes, nil
+	case kindInput:
+		return inputBox(r.title, r.text, r.value)
+	case kindOpenFile, kindSaveFile:
+		return fileDialog(r)
+	case kindSelectDirectory:
+		return selectDirectory(r.title)
+	}
+	return "", false, ErrUnsupported
+}
+
+func messageBox(title, text string, flags uint) int {
+	ret, _, _ := messageBoxW.Call(0, uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(text))),
+		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(title))), uintptr(flags))
+	return int(ret)
+}
+
+// inputBox uses PowerShell as there is no text input dialog in Win32 API.
+// Strings are passed through the environment, so they are never parsed as a
+// part of the script. InputBox returns an empty string when canceled.
+func inputBox(title, text, value string) (string, bool, error) {
+	script := `Add-Type -AssemblyName Microsoft.VisualBasic;` +
+		`[Microsoft.VisualBasic.Interaction]::InputBox($env:LORCA_DIALOG_TEXT, $env:LORCA_DIALOG_TITLE, $env:LORCA_DIALOG_VALUE)`
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.Env = append(os.Environ(),
+		"LORCA_DIALOG_TITLE="+title, "LORCA_DIALOG_TEXT="+text, "LORCA_DIALOG_VALUE="+value)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", false, err
+	}
+	s := strings.TrimRight(string(out), "\r\n")
+	return s, s != "", nil
+}
+
+func fileDialog(r request) (string, bool, error) {
+	filter := ""
+	for _, f := range r.filters {
+		filter = filter + f.Name + "\x00" + strings.Join(f.Patterns, ";") + "\x00"
+	}
+	buf := make([]uint16, 65536)
+	copy(buf, syscall.StringToUTF16(r.value))
+	ofn := openFileName{
+		file:    &buf[0],
+		maxFile: uint32(len(buf)),
+		title:   syscall.StringToUTF16Ptr(r.title),
+		flags:   ofnExplorer | ofnNoChangeDir | ofnPathMustExist,
+	}
+	ofn.structSize = uint32(unsafe.Sizeof(ofn))
+	if filter != "" {
+		// Filter is terminated with two NUL characters
+		ofn.filter = &utf16.Encode([]rune(filter + "\x00"))[0]
+		ofn.filterIndex = 1
+	}
+	proc := getOpenFileNameW
+	if r.kind == kindSaveFile {
+		proc = getSaveFileNameW
+		ofn.flags |= ofnOverwritePrompt
+	} else {
+		ofn.flags |= ofnFileMustExist
+		if r.multiple {
+			ofn.flags |= ofnAllowMultiSelect
+		}
+	}
+	if ret, _, _ := proc.Call(uintptr(unsafe.Pointer(&ofn))); ret == 0 {
+		return "", false, nil
+	}
+	// Multiple selection returns the directory followed by the file names,
+	// all separated by NUL and terminated by two NUL characters
+	parts := []string{}
+	for start, i := 0, 0; i < len(buf); i++ {
+		if buf[i] == 0 {
+			if i == start {
+				break
+			}
+			parts = append(parts, syscall.UTF16ToString(buf[start:i]))
+			start = i + 1
+		}
+	}
+	if len(parts) > 1 {
+		dir := strings.TrimSuffix(parts[0], `\`)
+		for i, name := range parts[1:] {
+			parts[i+1] = dir + `\` + name
+		}
+		parts = parts[1:]
+	}
+	return strings.Join(parts, "\n"), len(parts) > 0, nil
+}
+
+func selectDirectory(title string) (string, bool, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	coInitializeEx.Call(0, coinitApartmentThreaded)
+	name := make([]uint16, syscall.MAX_PATH)
+	bi := browseInfo{
+		displayName: &name[0],
+		title:       syscall.StringToUTF16Ptr(title),
+		flags:       bifReturnOnlyFSDirs | bifNewDialogStyle,
+	}
+	idl, _, _ := shBrowseForFolderW.Call(uintptr(unsafe.Pointer(&bi)))
+	if idl == 0 {
+		return "", false, nil
+	}
+	defer coTaskMemFree.Call(idl)
+	path := make([]uint16, syscall.MAX_PATH)
+	if ret, _, _ := shGetPathFromIDListW.Call(idl, uintptr(unsafe.Pointer(&path[0]))); ret == 0 {
+		return "", false, nil
+	}
+	return syscall.UTF16ToString(path), true, nil
+}
@@ -0,0 +1,259 @@
+package lorca
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DownloadState defines the state of a download, possible values are
+// "inProgress", "completed" and "canceled".
+type DownloadState string
+
+const (
+	// DownloadInProgress defines a download that is still being received
+	DownloadInProgress DownloadState = "inProgress"
+	// DownloadCompleted defines a successfully finished download
+	DownloadCompleted DownloadState = "completed"
+	// DownloadCanceled defines a download canceled by the handler or the user
+	DownloadCanceled DownloadState = "canceled"
+)
+
+// ErrDownloadCanceled is returned by Download.Wait if the download has been
+// canceled.
+var ErrDownloadCanceled = errors.New("download canceled")
+
+// ErrDownloadUndecided is returned by Download.Wait if neither Accept nor
+// Cancel has been called yet, as the download would never finish otherwise.
+var ErrDownloadUndecided = errors.New("download neither accepted nor canceled")
+
+// Download is a file download started by the page. Download handler must call
+// either Accept or Cancel, otherwise the download is canceled once the handler
+// returns.
+type Download struct {
+	URL               string
+	SuggestedFilename string
+
+	mu       sync.Mutex
+	chrome   *chrome
+	guid     string
+	tmp      string // file name chosen by Chrome inside of the downloads dir
+	dest     string
+	decided  bool
+	saving   bool
+	state    DownloadState
+	received int64
+	total    int64
+	err      error
+	done     chan struct{}
+}
+
+// Accept saves the download into the given path once it's completed.
+func (d *Download) Accept(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.decided {
+		d.dest, d.decided = path, true
+		d.finish()
+	}
+}
+
+// Cancel cancels the download, unless it has been already saved or canceled.
+func (d *Download) Cancel() error {
+	d.mu.Lock()
+	select {
+	case <-d.done:
+		d.mu.Unlock()
+		return nil
+	default:
+	}
+	if d.saving {
+		d.mu.Unlock()
+		return nil
+	}
+	d.decided, d.state = true, DownloadCanceled
+	d.finish()
+	d.mu.Unlock()
+	_, err := d.chrome.send("Browser.cancelDownload", h{"guid": d.guid})
+	return err
+}
+
+// Progress returns the number of bytes received so far and the total size of
+// the download, which is zero if unknown.
+func (d *Download) Progress() (received, total int64, state DownloadState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.received, d.total, d.state
+}
+
+// Wait waits until the download is either saved to the accepted path, which
+// is returned, or canceled. It returns ErrDownloadUndecided right away if the
+// download has been neither accepted nor canceled.
+func (d *Download) Wait() (string, error) {
+	d.mu.Lock()
+	decided := d.decided
+	d.mu.Unlock()
+	if !decided {
+		return "", ErrDownloadUndecided
+	}
+	<-d.done
+	return d.dest, d.err
+}
+
+func (d *Download) progress(received, total int64, state DownloadState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.received, d.total = received, total
+	if d.state == DownloadCanceled {
+		// Canceled by the handler, Chrome might have completed the file since
+		os.Remove(d.tmp)
+		return
+	}
+	d.state = state
+	d.finish()
+}
+
+// finish reports the cancellation or starts moving the completed file into its
+// destination. It must be called with the mutex held.
+func (d *Download) finish() {
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+	switch {
+	case d.saving:
+	case d.state == DownloadCanceled:
+		os.Remove(d.tmp)
+		d.err = ErrDownloadCanceled
+		close(d.done)
+	case d.state == DownloadCompleted && d.decided:
+		// Copying across devices may take a while, don't block the read loop
+		d.saving = true
+		d.chrome.saving.Add(1)
+		go d.save()
+	}
+}
+
+func (d *Download) save() {
+	defer d.chrome.saving.Done()
+	err := moveFile(d.tmp, d.dest)
+	d.mu.Lock()
+	d.err = err
+	close(d.done)
+	d.mu.Unlock()
+}
+
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	// Rename fails across devices, fall back to copying
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// onDownload makes Chrome save downloads into a temporary directory and calls
+// f for each download. Nil function restores the default browser behavior.
+func (c *chrome) onDownload(f func(d *Download)) error {
+	if f == nil {
+		c.Lock()
+		c.download = nil
+		c.Unlock()
+		_, err := c.send("Browser.setDownloadBehavior", h{"behavior": "default"})
+		return err
+	}
+	c.Lock()
+	dir := c.downloadDir
+	first := dir == ""
+	c.Unlock()
+	if first {
+		var err error
+		if dir, err = ioutil.TempDir("", "lorca-downloads"); err != nil {
+			return err
+		}
+	}
+	c.Lock()
+	c.download, c.downloadDir = f, dir
+	c.Unlock()
+	if first {
+		downloads := map[string]*Download{}
+		c.on("Browser.downloadWillBegin", func(params json.RawMessage) {
+			ev := struct {
+				GUID     string `json:"guid"`
+				URL      string `json:"url"`
+				Filename string `json:"suggestedFilename"`
+			}{}
+			json.Unmarshal(params, &ev)
+			c.Lock()
+			f := c.download
+			if _, ok := downloads[ev.GUID]; ok || f == nil {
+				c.Unlock()
+				return
+			}
+			d := &Download{
+				URL:               ev.URL,
+				SuggestedFilename: ev.Filename,
+				chrome:            c,
+				guid:              ev.GUID,
+				tmp:               filepath.Join(dir, ev.GUID),
+				state:             DownloadInProgress,
+				done:              make(chan struct{}),
+			}
+			downloads[ev.GUID] = d
+			c.Unlock()
+			go func() {
+				f(d)
+				d.mu.Lock()
+				decided := d.decided
+				d.mu.Unlock()
+				if !decided {
+					d.Cancel()
+				}
+			}()
+		})
+		c.on("Browser.downloadProgress", func(params json.RawMessage) {
+			ev := struct {
+				GUID     string        `json:"guid"`
+				Total    float64       `json:"totalBytes"`
+				Received float64       `json:"receivedBytes"`
+				State    DownloadState `json:"state"`
+			}{}
+			json.Unmarshal(params, &ev)
+			c.Lock()
+			d, ok := downloads[ev.GUID]
+			if ok && ev.State != DownloadInProgress {
+				delete(downloads, ev.GUID)
+			}
+			c.Unlock()
+			if ok {
+				d.progress(int64(ev.Received), int64(ev.Total), ev.State)
+			}
+		})
+	}
+	_, err := c.send("Browser.setDownloadBehavior", h{
+		"behavior":      "allowAndName",
+		"downloadPath":  dir,
+		"eventsEnabled": true,
+	})
+	return err
+}
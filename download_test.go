@@ -0,0 +1,105 @@
+package lorca
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	if err := ui.Handle("https://app.lorca/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="hello.txt"`)
+		w.Write([]byte("Hello, world!"))
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "saved.txt")
+	downloads := make(chan *Download, 1)
+	if err := ui.OnDownload(func(d *Download) {
+		d.Accept(dest)
+		downloads <- d
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ui.Load("https://app.lorca/hello.txt")
+
+	d := <-downloads
+	if d.SuggestedFilename != "hello.txt" || d.URL != "https://app.lorca/hello.txt" {
+		t.Fatal(d.SuggestedFilename, d.URL)
+	}
+	if path, err := d.Wait(); err != nil || path != dest {
+		t.Fatal(path, err)
+	}
+	if b, err := ioutil.ReadFile(dest); err != nil || string(b) != "Hello, world!" {
+		t.Fatal(string(b), err)
+	}
+	if received, _, state := d.Progress(); received != 13 || state != DownloadCompleted {
+		t.Fatal(received, state)
+	}
+}
+
+func TestDownloadCancelCompleted(t *testing.T) {
+	// The browser is gone, so Browser.cancelDownload fails right away
+	c := newChromeState(Options{})
+	c.exitErr = &ExitError{Reason: ExitClosed}
+	tmp := filepath.Join(t.TempDir(), "guid")
+	if err := ioutil.WriteFile(tmp, []byte("Hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := &Download{chrome: c, tmp: tmp, state: DownloadInProgress, done: make(chan struct{})}
+	d.progress(5, 5, DownloadCompleted)
+	d.Cancel()
+	if _, err := d.Wait(); err != ErrDownloadCanceled {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if _, _, state := d.Progress(); state != DownloadCanceled {
+		t.Fatal(state)
+	}
+	// Cancel after the download is finished is a no-op
+	if err := d.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadAcceptCompleted(t *testing.T) {
+	c := newChromeState(Options{})
+	dir := t.TempDir()
+	tmp, dest := filepath.Join(dir, "guid"), filepath.Join(dir, "saved.txt")
+	if err := ioutil.WriteFile(tmp, []byte("Hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := &Download{chrome: c, tmp: tmp, state: DownloadInProgress, done: make(chan struct{})}
+	// Wait doesn't block until the download is accepted or canceled
+	if _, err := d.Wait(); err != ErrDownloadUndecided {
+		t.Fatal(err)
+	}
+	d.progress(5, 5, DownloadCompleted)
+	d.Accept(dest)
+	// The file is moved outside of the read loop, Close waits for it
+	c.saving.Wait()
+	if b, err := ioutil.ReadFile(dest); err != nil || string(b) != "Hello" {
+		t.Fatal(string(b), err)
+	}
+	if path, err := d.Wait(); err != nil || path != dest {
+		t.Fatal(path, err)
+	}
+	// Cancel after the download is saved is a no-op
+	if err := d.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, state := d.Progress(); state != DownloadCompleted {
+		t.Fatal(state)
+	}
+}
@@ -0,0 +1,90 @@
+package lorca
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Discovery is a method of finding the DevTools endpoint of a started
+// browser.
+type Discovery string
+
+const (
+	// DiscoveryAuto uses whichever of the methods finds the endpoint first
+	DiscoveryAuto Discovery = ""
+	// DiscoveryStderr parses the "DevTools listening on" line printed by the
+	// browser to stderr
+	DiscoveryStderr Discovery = "stderr"
+	// DiscoveryActivePort reads the DevToolsActivePort file the browser writes
+	// into the user profile directory, which works even if stderr is buffered
+	// or reworded by wrapper scripts
+	DiscoveryActivePort Discovery = "DevToolsActivePort"
+)
+
+// Endpoint is the DevTools endpoint the UI is connected to.
+type Endpoint struct {
+	URL       string
+	Discovery Discovery
+}
+
+// activePortPoll is how often the DevToolsActivePort file is checked.
+var activePortPoll = 50 * time.Millisecond
+
+// activePortFile returns the DevToolsActivePort file path for the browser
+// command line, or an empty string if the profile directory is not known.
+func activePortFile(args []string) string {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--user-data-dir=") {
+			return filepath.Join(strings.TrimPrefix(arg, "--user-data-dir="), "DevToolsActivePort")
+		}
+	}
+	return ""
+}
+
+// parseActivePort returns the websocket URL from the DevToolsActivePort file
+// contents: the port on the first line and the browser target path on the
+// second one.
+func parseActivePort(b []byte) (string, error) {
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) < 2 {
+		return "", fmt.Errorf("invalid DevToolsActivePort: %q", b)
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil || port <= 0 || port > 65535 {
+		return "", fmt.Errorf("invalid DevToolsActivePort port: %q", lines[0])
+	}
+	path := strings.TrimSpace(lines[1])
+	if !strings.HasPrefix(path, "/devtools/browser/") {
+		return "", fmt.Errorf("invalid DevToolsActivePort path: %q", path)
+	}
+	return fmt.Sprintf("ws://127.0.0.1:%d%s", port, path), nil
+}
+
+// watchActivePort polls the file until it contains a valid endpoint. The file
+// must be removed before the browser is started, otherwise a stale endpoint
+// of the previous browser might be found.
+func watchActivePort(name string, stop <-chan struct{}) <-chan string {
+	c := make(chan string, 1)
+	go func() {
+		t := time.NewTicker(activePortPoll)
+		defer t.Stop()
+		for {
+			if b, err := ioutil.ReadFile(name); err == nil {
+				if url, err := parseActivePort(b); err == nil {
+					c <- url
+					return
+				}
+			}
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return c
+}
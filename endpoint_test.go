@@ -0,0 +1,71 @@
+//go:build !windows
+// +build !windows
+
+package lorca
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestParseActivePort(t *testing.T) {
+	for _, test := range []struct {
+		File string
+		URL  string
+	}{
+		{"9222\n/devtools/browser/abc\n", "ws://127.0.0.1:9222/devtools/browser/abc"},
+		{"9222\r\n/devtools/browser/abc", "ws://127.0.0.1:9222/devtools/browser/abc"},
+		{"9222\n", ""},
+		{"port\n/devtools/browser/abc", ""},
+		{"9222\n/json/version", ""},
+	} {
+		if url, err := parseActivePort([]byte(test.File)); url != test.URL || (err == nil) != (test.URL != "") {
+			t.Error(test.File, url, err)
+		}
+	}
+}
+
+func TestActivePortDiscovery(t *testing.T) {
+	paths := make(chan string, 1)
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		paths <- ws.Request().URL.Path
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	dir := t.TempDir()
+	portFile := filepath.Join(dir, "DevToolsActivePort")
+	// Stale file of a browser that is no longer running must be ignored
+	if err := ioutil.WriteFile(portFile, []byte("1\n/devtools/browser/stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf(`sleep 0.2; printf '%s\n/devtools/browser/fresh' > "$1/DevToolsActivePort"; sleep 30`, port)
+	cmd := exec.Command("sh", "-c", script, "sh", dir, "--user-data-dir="+dir)
+	_, err := newChrome(cmd, Options{StartTimeout: 5 * time.Second})
+	if errors.Is(err, ErrStartTimeout) {
+		t.Fatal(err)
+	}
+	if path := <-paths; path != "/devtools/browser/fresh" {
+		t.Fatal(path)
+	}
+
+	// Only stderr is used, so the file is not found
+	os.Remove(portFile)
+	_, err = newChrome(exec.Command("sh", "-c", script, "sh", dir, "--user-data-dir="+dir), Options{
+		StartTimeout: 500 * time.Millisecond,
+		Discovery:    DiscoveryStderr,
+	})
+	if !errors.Is(err, ErrStartTimeout) {
+		t.Fatal(err)
+	}
+}
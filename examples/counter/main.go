@@ -2,20 +2,17 @@ package main
 
 import (
 	"embed"
-	"fmt"
+	"io/fs"
 	"log"
-	"net"
-	"net/http"
 	"os"
 	"os/signal"
-	"runtime"
 	"sync"
 
 	"github.com/zserge/lorca"
 )
 
 //go:embed www
-var fs embed.FS
+var www embed.FS
 
 // Go types that are bound to the UI must be thread-safe, because each binding
 // is executed in its own goroutine. In this simple case we may use atomic
@@ -38,11 +35,10 @@ func (c *counter) Value() int {
 }
 
 func main() {
-	args := []string{}
-	if runtime.GOOS == "linux" {
-		args = append(args, "--class=Lorca")
-	}
-	ui, err := lorca.New("", "", 480, 320, args...)
+	ui, err := lorca.NewWithOptions(lorca.Options{
+		Bounds: lorca.Bounds{Width: 480, Height: 320},
+		Class:  "Lorca",
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -62,13 +58,16 @@ func main() {
 	// You may also use `data:text/html,<base64>` approach to load initial HTML,
 	// e.g: ui.Load("data:text/html," + url.PathEscape(html))
 
-	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	// Embedded files are served in-process under a private origin, no TCP port
+	// is opened.
+	root, err := fs.Sub(www, "www")
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer ln.Close()
-	go http.Serve(ln, http.FileServer(http.FS(fs)))
-	ui.Load(fmt.Sprintf("http://%s/www", ln.Addr()))
+	if err := ui.ServeFS("https://app.lorca/", root); err != nil {
+		log.Fatal(err)
+	}
+	ui.Load("https://app.lorca/")
 
 	// You may use console.log to debug your JS code, it will be printed via
 	// log.Println(). Also exceptions are printed in a similar manner.
@@ -78,7 +77,7 @@ func main() {
 	`)
 
 	// Wait until the interrupt signal arrives or browser window is closed
-	sigc := make(chan os.Signal)
+	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, os.Interrupt)
 	select {
 	case <-sigc:
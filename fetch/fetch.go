@@ -0,0 +1,417 @@
+// Package fetch installs pinned Chrome for Testing or Chromium builds into a
+// local cache, so that apps don't depend on the browser installed by the user.
+// Archives may be downloaded from the official storage, from a mirror or from
+// a local directory, and are verified with SHA-256 before being unpacked.
+//
+// The returned executable can be used with Lorca:
+//
+//	exe, err := fetch.Install(ctx, fetch.Build{Version: "120.0.6099.109", SHA256: "..."})
+//	...
+//	lorca.ChromeExecutable = func() string { return exe }
+package fetch
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the official Chrome for Testing storage.
+const DefaultBaseURL = "https://storage.googleapis.com/chrome-for-testing-public"
+
+// ErrChecksum is returned if the downloaded archive doesn't match the expected
+// SHA-256 checksum.
+var ErrChecksum = errors.New("fetch: checksum mismatch")
+
+// Build is a pinned browser build.
+type Build struct {
+	// Version is the browser version, e.g. "120.0.6099.109".
+	Version string
+	// Platform is the Chrome for Testing platform name: "linux64", "mac-x64",
+	// "mac-arm64", "win32" or "win64". The current platform is used if it's
+	// empty.
+	Platform string
+	// SHA256 is the hex encoded checksum of the archive, it's required.
+	SHA256 string
+	// Archive is the archive path relative to the base URL. Chrome for Testing
+	// layout "<version>/<platform>/chrome-<platform>.zip" is used if it's
+	// empty. Set it to install Chromium snapshots or custom builds.
+	Archive string
+	// Executable is the browser executable path inside the archive. Chrome for
+	// Testing executable is used if it's empty.
+	Executable string
+}
+
+// Installer downloads and unpacks browser builds.
+type Installer struct {
+	// BaseURL is where archives are downloaded from. It may be an http(s) URL,
+	// a file:// URL or a local directory. DefaultBaseURL is used if it's empty.
+	BaseURL string
+	// CacheDir is where builds are installed, "lorca/browsers" in the user
+	// cache directory is used if it's empty.
+	CacheDir string
+	// Client is used for http(s) downloads, http.DefaultClient is used if it's
+	// nil.
+	Client *http.Client
+}
+
+// Install installs the build using the default installer, see
+// Installer.Install.
+func Install(ctx context.Context, b Build) (string, error) {
+	return (&Installer{}).Install(ctx, b)
+}
+
+// Install downloads, verifies and unpacks the build unless it's already
+// installed, and returns the path to the browser executable. It's safe to
+// call it concurrently from multiple processes sharing the cache directory.
+func (i *Installer) Install(ctx context.Context, b Build) (string, error) {
+	b, err := b.normalize()
+	if err != nil {
+		return "", err
+	}
+	cache := i.CacheDir
+	if cache == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		cache = filepath.Join(dir, "lorca", "browsers")
+	}
+	if err := os.MkdirAll(cache, 0755); err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cache, b.Platform+"-"+b.Version+"-"+b.SHA256[:12])
+	exe := filepath.Join(dir, filepath.FromSlash(b.Executable))
+	if _, err := os.Stat(exe); err == nil {
+		return exe, nil
+	}
+
+	unlock, err := lock(ctx, dir+".lock")
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	// Another process might have finished the installation while we waited
+	if _, err := os.Stat(exe); err == nil {
+		return exe, nil
+	}
+
+	archive, err := ioutil.TempFile(cache, ".download-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	if err := i.download(ctx, b, archive); err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempDir(cache, ".unpack-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := unzip(archive.Name(), tmp); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(tmp, filepath.FromSlash(b.Executable))); err != nil {
+		return "", fmt.Errorf("fetch: %s not found in the archive", b.Executable)
+	}
+	// Remove leftovers of an interrupted installation, the lock is held
+	os.RemoveAll(dir)
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", err
+	}
+	return exe, nil
+}
+
+func (b Build) normalize() (Build, error) {
+	if b.Version == "" {
+		return b, errors.New("fetch: build version is required")
+	}
+	if sum, err := hex.DecodeString(b.SHA256); err != nil || len(sum) != sha256.Size {
+		return b, errors.New("fetch: build SHA-256 checksum is required")
+	}
+	b.SHA256 = strings.ToLower(b.SHA256)
+	if b.Platform == "" {
+		b.Platform = currentPlatform()
+		if b.Platform == "" {
+			return b, fmt.Errorf("fetch: unsupported platform %s/%s", runtime.GOOS, runtime.GOARCH)
+		}
+	}
+	if b.Archive == "" {
+		b.Archive = path.Join(b.Version, b.Platform, "chrome-"+b.Platform+".zip")
+	}
+	if b.Executable == "" {
+		root := "chrome-" + b.Platform
+		switch {
+		case strings.HasPrefix(b.Platform, "mac"):
+			b.Executable = root + "/Google Chrome for Testing.app/Contents/MacOS/Google Chrome for Testing"
+		case strings.HasPrefix(b.Platform, "win"):
+			b.Executable = root + "/chrome.exe"
+		default:
+			b.Executable = root + "/chrome"
+		}
+	}
+	return b, nil
+}
+
+func currentPlatform() string {
+	switch runtime.GOOS + "/" + runtime.GOARCH {
+	case "linux/amd64":
+		return "linux64"
+	case "darwin/amd64":
+		return "mac-x64"
+	case "darwin/arm64":
+		return "mac-arm64"
+	case "windows/386":
+		return "win32"
+	case "windows/amd64", "windows/arm64":
+		return "win64"
+	}
+	return ""
+}
+
+// download copies the archive into w and verifies its checksum.
+func (i *Installer) download(ctx context.Context, b Build, w io.Writer) error {
+	r, err := i.open(ctx, b.Archive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), r); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != b.SHA256 {
+		return fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksum, b.Archive, sum, b.SHA256)
+	}
+	return nil
+}
+
+func (i *Installer) open(ctx context.Context, name string) (io.ReadCloser, error) {
+	base := i.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		dir := base
+		if err == nil && u.Scheme == "file" {
+			dir = filePath(u)
+		}
+		return os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(base, "/")+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := i.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("fetch: %s: %s", req.URL, res.Status)
+	}
+	return res.Body, nil
+}
+
+// filePath converts a file URL into a local path. On Windows the path of
+// file:///C:/dir starts with a slash before the drive letter, and
+// file://server/share is a UNC path.
+func filePath(u *url.URL) string {
+	p := u.Path
+	switch host := u.Host; {
+	case len(host) == 2 && host[1] == ':':
+		// file://C:/dir puts the drive letter into the host
+		p = host + p
+	case host != "" && host != "localhost":
+		p = "//" + host + p
+	case filepath.VolumeName(filepath.FromSlash(strings.TrimPrefix(p, "/"))) != "":
+		p = strings.TrimPrefix(p, "/")
+	}
+	return filepath.FromSlash(p)
+}
+
+// unzip extracts the archive into dir, keeping file modes and symlinks, which
+// are used by macOS app bundles. Symlinks are created after all the other
+// files and only if they point inside dir, so nothing is written through them.
+func unzip(name, dir string) error {
+	z, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	links := map[*zip.File]string{}
+	for _, f := range z.File {
+		target := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("fetch: invalid file name in the archive: %s", f.Name)
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			links[f] = target
+		} else if err := unzipFile(f, target); err != nil {
+			return err
+		}
+	}
+	// Symlinks may point to other symlinks, so each one is created once its
+	// destination exists
+	for len(links) > 0 {
+		created := false
+		for f, target := range links {
+			ok, err := unzipLink(f, root, target)
+			if err != nil {
+				return err
+			} else if ok {
+				delete(links, f)
+				created = true
+			}
+		}
+		if !created {
+			for f := range links {
+				return fmt.Errorf("fetch: dangling symlink in the archive: %s", f.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func unzipFile(f *zip.File, target string) error {
+	mode := f.Mode()
+	if mode.IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// unzipLink creates the symlink if its destination exists and is inside root.
+// It returns false if the destination doesn't exist yet.
+func unzipLink(f *zip.File, root, target string) (bool, error) {
+	r, err := f.Open()
+	if err != nil {
+		return false, err
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return false, err
+	}
+	link := filepath.FromSlash(string(b))
+	if filepath.IsAbs(link) || filepath.VolumeName(link) != "" {
+		return false, fmt.Errorf("fetch: absolute symlink in the archive: %s", f.Name)
+	}
+	// All the symlinks created so far point inside root, so are the parents
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return false, err
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return false, err
+	}
+	// Not joined with filepath.Join, which would clean ".." lexically before
+	// the symlinks are resolved
+	dest, err := filepath.EvalSymlinks(parent + string(os.PathSeparator) + link)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !within(root, parent) || !within(root, dest) {
+		return false, fmt.Errorf("fetch: symlink pointing outside of the archive: %s", f.Name)
+	}
+	return true, os.Symlink(link, target)
+}
+
+// within reports whether the path is dir or inside of it.
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// lock locks the file exclusively for all processes, waiting until it's
+// released by the current owner. The OS releases the lock if the owner
+// crashes, so there are no stale locks to remove.
+func lock(ctx context.Context, name string) (unlock func(), err error) {
+	for {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok && lockedFile(f, name) {
+			return func() {
+				// Removed while locked, so that waiting processes notice it.
+				// Windows doesn't allow that while the file is open, but
+				// neither while another process has it open.
+				os.Remove(name)
+				unlockFile(f)
+				f.Close()
+				if runtime.GOOS == "windows" {
+					os.Remove(name)
+				}
+			}, nil
+		} else if ok {
+			// The previous owner has removed the file, lock the new one
+			unlockFile(f)
+			f.Close()
+			continue
+		}
+		f.Close()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// lockedFile reports whether the open file is still the one at the path.
+func lockedFile(f *os.File, name string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	ni, err := os.Stat(name)
+	return err == nil && os.SameFile(fi, ni)
+}
@@ -0,0 +1,265 @@
+package fetch
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testArchive(t *testing.T) ([]byte, string) {
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	hdr := &zip.FileHeader{Name: "chrome-linux64/chrome", Method: zip.Deflate}
+	hdr.SetMode(0755)
+	w, err := z.CreateHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("#!/bin/sh\necho Chrome\n"))
+	if w, err = z.Create("chrome-linux64/locales/en-US.pak"); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("en-US"))
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return buf.Bytes(), hex.EncodeToString(sum[:])
+}
+
+func TestInstall(t *testing.T) {
+	archive, sum := testArchive(t)
+	var downloads int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/120.0.6099.109/linux64/chrome-linux64.zip" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		w.Write(archive)
+	}))
+	defer srv.Close()
+
+	cache := t.TempDir()
+	b := Build{Version: "120.0.6099.109", Platform: "linux64", SHA256: sum}
+	paths := make([]string, 4)
+	wg := sync.WaitGroup{}
+	for n := range paths {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			// Separate installers share nothing but the cache directory
+			i := &Installer{BaseURL: srv.URL, CacheDir: cache}
+			exe, err := i.Install(context.Background(), b)
+			if err != nil {
+				t.Error(err)
+			}
+			paths[n] = exe
+		}(n)
+	}
+	wg.Wait()
+	if downloads != 1 {
+		t.Error("archive downloaded", downloads, "times")
+	}
+	for _, exe := range paths {
+		if exe != paths[0] || filepath.Base(exe) != "chrome" {
+			t.Fatal(paths)
+		}
+	}
+	info, err := os.Stat(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Error(info.Mode())
+	}
+	entries, _ := ioutil.ReadDir(cache)
+	if len(entries) != 1 {
+		t.Error("temporary files are left in the cache", entries)
+	}
+}
+
+func TestInstallFromDirectory(t *testing.T) {
+	archive, sum := testArchive(t)
+	mirror := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(mirror, "chromium.zip"), archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileURL := "file://" + filepath.ToSlash(mirror)
+	if !strings.HasPrefix(mirror, "/") {
+		// Windows path needs an empty host, file:///C:/dir
+		fileURL = "file:///" + filepath.ToSlash(mirror)
+	}
+	for _, base := range []string{mirror, fileURL} {
+		i := &Installer{BaseURL: base, CacheDir: t.TempDir()}
+		exe, err := i.Install(context.Background(), Build{
+			Version:    "1200000",
+			Platform:   "linux64",
+			SHA256:     sum,
+			Archive:    "chromium.zip",
+			Executable: "chrome-linux64/chrome",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, err := ioutil.ReadFile(exe); err != nil || !bytes.Contains(b, []byte("Chrome")) {
+			t.Fatal(string(b), err)
+		}
+	}
+}
+
+func TestFilePath(t *testing.T) {
+	tests := []struct {
+		URL  string
+		Path string
+	}{
+		{"file:///tmp/mirror", "/tmp/mirror"},
+		{"file://localhost/tmp/mirror", "/tmp/mirror"},
+	}
+	if runtime.GOOS == "windows" {
+		tests = []struct {
+			URL  string
+			Path string
+		}{
+			{"file:///C:/mirror", `C:\mirror`},
+			{"file://C:/mirror", `C:\mirror`},
+			{"file://localhost/C:/mirror", `C:\mirror`},
+			{"file://server/share/mirror", `\\server\share\mirror`},
+		}
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := filePath(u); p != test.Path {
+			t.Error(test.URL, p, test.Path)
+		}
+	}
+}
+
+func TestInstallChecksum(t *testing.T) {
+	archive, _ := testArchive(t)
+	mirror := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(mirror, "chromium.zip"), archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := t.TempDir()
+	i := &Installer{BaseURL: mirror, CacheDir: cache}
+	sum := sha256.Sum256([]byte("something else"))
+	b := Build{Version: "1", Platform: "linux64", SHA256: hex.EncodeToString(sum[:]), Archive: "chromium.zip"}
+	if _, err := i.Install(context.Background(), b); !errors.Is(err, ErrChecksum) {
+		t.Fatal(err)
+	}
+	if entries, _ := ioutil.ReadDir(cache); len(entries) != 0 {
+		t.Error("nothing should be installed", entries)
+	}
+	b.SHA256 = ""
+	if _, err := i.Install(context.Background(), b); err == nil {
+		t.Fatal("checksum must be required")
+	}
+}
+
+func symlinkArchive(t *testing.T, entries [][2]string) string {
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e[0]}
+		if strings.HasPrefix(e[1], "->") {
+			hdr.SetMode(os.ModeSymlink | 0777)
+			e[1] = strings.TrimPrefix(e[1], "->")
+		} else {
+			hdr.SetMode(0644)
+		}
+		w, err := z.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e[1]))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "archive.zip")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestUnzipSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+	// Links are created in any order, as long as they point inside
+	dir := t.TempDir()
+	if err := unzip(symlinkArchive(t, [][2]string{
+		{"App.framework/Libraries", "->Versions/Current/Libraries"},
+		{"App.framework/Versions/Current", "->A"},
+		{"App.framework/Versions/A/Libraries/lib.so", "lib"},
+	}), dir); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "App.framework/Libraries/lib.so")); err != nil || string(b) != "lib" {
+		t.Fatal(string(b), err)
+	}
+
+	for _, entries := range [][][2]string{
+		{{"a", "->/etc"}, {"a/x", "x"}},
+		{{"a", "->../outside"}, {"a/x", "x"}},
+		{{"a/q", "->.."}, {"b", "->a/q/../outside"}},
+		{{"a", "->missing"}},
+	} {
+		base := t.TempDir()
+		os.Mkdir(filepath.Join(base, "outside"), 0755)
+		dir := filepath.Join(base, "dir")
+		os.Mkdir(dir, 0755)
+		if err := unzip(symlinkArchive(t, entries), dir); err == nil {
+			t.Error(entries)
+		}
+		if files, _ := ioutil.ReadDir(filepath.Join(base, "outside")); len(files) != 0 {
+			t.Error("file written outside", entries)
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "build.lock")
+	unlock, err := lock(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := lock(ctx, name); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	locked := make(chan func())
+	go func() {
+		unlock, err := lock(context.Background(), name)
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+	unlock()
+	(<-locked)()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatal("lock file left behind", err)
+	}
+}
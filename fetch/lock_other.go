@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package fetch
+
+import "os"
+
+// tryLock always succeeds, as file locking is not supported on this platform,
+// so concurrent installations are not serialized.
+func tryLock(f *os.File) (bool, error) { return true, nil }
+
+func unlockFile(f *os.File) error { return nil }
@@ -0,0 +1,96 @@
+package lorca
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// FileChooserRequest describes a file chooser opened by the page, e.g. after
+// a click on <input type=file>.
+type FileChooserRequest struct {
+	// Multiple is true if more than one file may be selected.
+	Multiple bool
+	// Accept contains file types from the accept attribute of the input, e.g.
+	// ".png" or "image/*". Empty list means that any file is accepted.
+	Accept []string
+}
+
+// onFileChooser intercepts file choosers and lets f select the files. If f
+// returns an error or no files, the file chooser is treated as canceled. Nil
+// function restores the default browser file chooser.
+func (c *chrome) onFileChooser(f func(FileChooserRequest) ([]string, error)) error {
+	c.Lock()
+	first := !c.fileChooserEnabled
+	c.fileChooser, c.fileChooserEnabled = f, true
+	c.Unlock()
+	if first {
+		c.on("Page.fileChooserOpened", func(params json.RawMessage) {
+			ev := struct {
+				Mode   string `json:"mode"`
+				NodeID int    `json:"backendNodeId"`
+			}{}
+			json.Unmarshal(params, &ev)
+			c.Lock()
+			f := c.fileChooser
+			c.Unlock()
+			if f != nil {
+				go c.chooseFiles(f, ev.NodeID, ev.Mode == "selectMultiple")
+			}
+		})
+	}
+	_, err := c.send("Page.setInterceptFileChooserDialog", h{"enabled": f != nil})
+	return err
+}
+
+func (c *chrome) chooseFiles(f func(FileChooserRequest) ([]string, error), node int, multiple bool) {
+	req := FileChooserRequest{Multiple: multiple}
+	if accept, err := c.inputAccept(node); err == nil {
+		for _, s := range strings.Split(accept, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				req.Accept = append(req.Accept, s)
+			}
+		}
+	}
+	files, err := f(req)
+	if err != nil || len(files) == 0 {
+		return
+	}
+	if !multiple {
+		files = files[:1]
+	}
+	for i, file := range files {
+		if abs, err := filepath.Abs(file); err == nil {
+			files[i] = abs
+		}
+	}
+	c.send("DOM.setFileInputFiles", h{"files": files, "backendNodeId": node})
+}
+
+// inputAccept returns the accept attribute of the file input element.
+func (c *chrome) inputAccept(node int) (string, error) {
+	res, err := c.send("DOM.resolveNode", h{"backendNodeId": node})
+	if err != nil {
+		return "", err
+	}
+	obj := struct {
+		Object struct {
+			ID string `json:"objectId"`
+		} `json:"object"`
+	}{}
+	if err := json.Unmarshal(res, &obj); err != nil {
+		return "", err
+	}
+	defer c.send("Runtime.releaseObject", h{"objectId": obj.Object.ID})
+	res, err = c.send("Runtime.callFunctionOn", h{
+		"objectId":            obj.Object.ID,
+		"functionDeclaration": "function() { return this.accept || ''; }",
+		"returnByValue":       true,
+	})
+	if err != nil {
+		return "", err
+	}
+	accept := ""
+	err = json.Unmarshal(res, &accept)
+	return accept, err
+}
@@ -0,0 +1,47 @@
+package lorca
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileChooser(t *testing.T) {
+	c, err := newChromeWithArgs(ChromeExecutable(), "--user-data-dir="+t.TempDir(), "--headless", "--remote-debugging-port=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.kill()
+
+	file := filepath.Join(t.TempDir(), "fixture.txt")
+	if err := ioutil.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	requests := make(chan FileChooserRequest, 1)
+	if err := c.onFileChooser(func(r FileChooserRequest) ([]string, error) {
+		requests <- r
+		return []string{file}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.evaluate(h{"expression": `
+		window.selected = new Promise(resolve => {
+			const input = document.createElement('input');
+			input.type = 'file';
+			input.accept = '.txt, text/plain';
+			input.multiple = true;
+			input.onchange = () => input.files[0].text().then(resolve);
+			document.body.appendChild(input);
+			input.click();
+		}), 0`, "userGesture": true}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	r := <-requests
+	if !r.Multiple || len(r.Accept) != 2 || r.Accept[0] != ".txt" || r.Accept[1] != "text/plain" {
+		t.Fatal(r)
+	}
+	if s, err := c.eval(`window.selected`); err != nil || string(s) != `"hello"` {
+		t.Fatal(string(s), err)
+	}
+}
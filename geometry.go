@@ -0,0 +1,218 @@
+package lorca
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// geometrySaveDelay is how long Track waits for the window to stop moving or
+// resizing before saving its bounds.
+var geometrySaveDelay = time.Second
+
+// Rect is a rectangular area of the screen in pixels.
+type Rect struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// WindowGeometry saves window bounds into a file and restores them on the
+// next launch. Position and size are those of the normal window state, so a
+// maximized window is restored into the size it had before being maximized.
+type WindowGeometry struct {
+	// Path is a JSON file where bounds are stored.
+	Path string
+
+	mu     sync.Mutex
+	bounds Bounds
+	dirty  bool
+	timer  *time.Timer
+	saveMu sync.Mutex
+}
+
+// NewWindowGeometry returns window geometry stored in the user config
+// directory, in a subdirectory named after the app, e.g.
+// ~/.config/<app>/window.json on Linux.
+func NewWindowGeometry(app string) (*WindowGeometry, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return &WindowGeometry{Path: filepath.Join(dir, app, "window.json")}, nil
+}
+
+// Load reads the saved bounds.
+func (g *WindowGeometry) Load() (Bounds, error) {
+	b := Bounds{}
+	data, err := ioutil.ReadFile(g.Path)
+	if err != nil {
+		return b, err
+	}
+	err = json.Unmarshal(data, &b)
+	return b, err
+}
+
+// Save writes the bounds into the file, creating its directory if needed.
+func (g *WindowGeometry) Save(b Bounds) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(g.Path), 0755); err != nil {
+		return err
+	}
+	tmp := g.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, g.Path)
+}
+
+// Restore applies the saved bounds to the window, making sure that the window
+// fits into the visible screen area. Nothing happens if no bounds are saved.
+func (g *WindowGeometry) Restore(ui UI) error {
+	b, err := g.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if b.Width <= 0 || b.Height <= 0 {
+		return nil
+	}
+	if areas, err := screenAreas(ui); err == nil {
+		b = clampBounds(b, areas)
+	}
+	// Restoring minimized window makes no sense
+	if b.WindowState == WindowStateMinimized {
+		b.WindowState = WindowStateNormal
+	}
+	g.mu.Lock()
+	g.bounds = b
+	g.mu.Unlock()
+	return ui.SetBounds(b)
+}
+
+// Track keeps the latest window bounds and saves them when the UI ends, UI.Close
+// returns only after they are saved. While the window is moved or resized they
+// are also saved once it stays still for a second, so they are not lost if the
+// app exits without closing the UI. Flush saves them right away.
+func (g *WindowGeometry) Track(ui UI) error {
+	b, err := ui.Bounds()
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	if b.WindowState == WindowStateNormal || g.bounds.Width == 0 {
+		g.bounds = b
+	} else {
+		g.bounds.WindowState = b.WindowState
+	}
+	g.mu.Unlock()
+	err = ui.OnWindowEvent(func(e WindowEvent) {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		switch e.Type {
+		case WindowMoved, WindowResized:
+			g.bounds = e.Bounds
+		case WindowStateChanged:
+			g.bounds.WindowState = e.Bounds.WindowState
+		default:
+			return
+		}
+		g.dirty = true
+		if g.timer == nil {
+			g.timer = time.AfterFunc(geometrySaveDelay, func() { g.Flush() })
+		} else {
+			g.timer.Reset(geometrySaveDelay)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if c, ok := ui.(interface{ onClose(f func()) }); ok {
+		c.onClose(func() { g.Flush() })
+	}
+	go func() {
+		<-ui.Done()
+		g.Flush()
+	}()
+	return nil
+}
+
+// Flush saves the tracked bounds if they have changed since the last save.
+func (g *WindowGeometry) Flush() error {
+	g.saveMu.Lock()
+	defer g.saveMu.Unlock()
+	g.mu.Lock()
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	b, dirty := g.bounds, g.dirty
+	g.dirty = false
+	g.mu.Unlock()
+	if !dirty {
+		return nil
+	}
+	return g.Save(b)
+}
+
+// screenAreas returns work areas of the screens available to the window.
+func screenAreas(ui UI) ([]Rect, error) {
+	screens, err := ui.Screens()
+	if err != nil {
+		return nil, err
+	}
+	areas := make([]Rect, len(screens))
+	for i, s := range screens {
+		areas[i] = s.WorkArea
+	}
+	return areas, nil
+}
+
+// bestArea returns the index of the area that the bounds overlap the most
+// with, or zero if they don't overlap any.
+func bestArea(b Bounds, areas []Rect) int {
+	best, overlap := 0, 0
+	for i, a := range areas {
+		w := minInt(b.Left+b.Width, a.Left+a.Width) - maxInt(b.Left, a.Left)
+		h := minInt(b.Top+b.Height, a.Top+a.Height) - maxInt(b.Top, a.Top)
+		if w > 0 && h > 0 && w*h > overlap {
+			best, overlap = i, w*h
+		}
+	}
+	return best
+}
+
+// clampBounds moves and shrinks the bounds to fit into the screen area they
+// overlap the most with, or into the first area if they don't overlap any.
+func clampBounds(b Bounds, areas []Rect) Bounds {
+	if len(areas) == 0 {
+		return b
+	}
+	best := areas[bestArea(b, areas)]
+	b.Width, b.Height = minInt(b.Width, best.Width), minInt(b.Height, best.Height)
+	b.Left = maxInt(best.Left, minInt(b.Left, best.Left+best.Width-b.Width))
+	b.Top = maxInt(best.Top, minInt(b.Top, best.Top+best.Height-b.Height))
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,125 @@
+package lorca
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClampBounds(t *testing.T) {
+	screens := []Rect{
+		{Left: 0, Top: 0, Width: 1920, Height: 1040},
+		{Left: 1920, Top: 0, Width: 1280, Height: 1024},
+	}
+	for _, test := range []struct {
+		Bounds  Bounds
+		Clamped Bounds
+	}{
+		// Fits into the first screen
+		{Bounds{Left: 100, Top: 100, Width: 800, Height: 600}, Bounds{Left: 100, Top: 100, Width: 800, Height: 600}},
+		// Mostly on the second screen, partially off-screen
+		{Bounds{Left: 2800, Top: 900, Width: 800, Height: 600}, Bounds{Left: 2400, Top: 424, Width: 800, Height: 600}},
+		// Larger than the screen
+		{Bounds{Left: -50, Top: -50, Width: 3000, Height: 2000}, Bounds{Left: 0, Top: 0, Width: 1920, Height: 1040}},
+		// Screen that has been disconnected
+		{Bounds{Left: -2000, Top: 0, Width: 800, Height: 600}, Bounds{Left: 0, Top: 0, Width: 800, Height: 600}},
+	} {
+		if b := clampBounds(test.Bounds, screens); b != test.Clamped {
+			t.Error(test.Bounds, b, test.Clamped)
+		}
+	}
+}
+
+func TestWindowGeometry(t *testing.T) {
+	g := &WindowGeometry{Path: filepath.Join(t.TempDir(), "app", "window.json")}
+	if _, err := g.Load(); err == nil {
+		t.Fatal("no bounds should be saved yet")
+	}
+	b := Bounds{Left: 10, Top: 20, Width: 640, Height: 480, WindowState: WindowStateMaximized}
+	if err := g.Save(b); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := g.Load(); err != nil || saved != b {
+		t.Fatal(saved, err)
+	}
+}
+
+// trackedUI reports the window events sent by the test.
+type trackedUI struct {
+	UI
+	done   chan struct{}
+	events func(WindowEvent)
+}
+
+func (u *trackedUI) Bounds() (Bounds, error) {
+	return Bounds{Width: 640, Height: 480, WindowState: WindowStateNormal}, nil
+}
+func (u *trackedUI) OnWindowEvent(f func(WindowEvent)) error { u.events = f; return nil }
+func (u *trackedUI) Done() <-chan struct{}                   { return u.done }
+
+func TestWindowGeometryTrack(t *testing.T) {
+	delay := geometrySaveDelay
+	geometrySaveDelay = time.Hour
+	defer func() { geometrySaveDelay = delay }()
+
+	g := &WindowGeometry{Path: filepath.Join(t.TempDir(), "window.json")}
+	ui := &trackedUI{done: make(chan struct{})}
+	if err := g.Track(ui); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		ui.events(WindowEvent{Type: WindowMoved, Bounds: Bounds{Left: i, Width: 640, Height: 480, WindowState: WindowStateNormal}})
+	}
+	// Nothing is written while the window is being moved
+	if _, err := g.Load(); err == nil {
+		t.Fatal("bounds saved too early")
+	}
+	close(ui.done)
+	for i := 0; i < 50; i++ {
+		if b, err := g.Load(); err == nil {
+			if b.Left != 9 {
+				t.Fatal(b)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("bounds not saved when the UI ended")
+}
+
+// closingUI reports the window events sent by the test and closes a UI
+// without a browser.
+type closingUI struct {
+	*trackedUI
+	ui *ui
+}
+
+func (u *closingUI) Close() error          { return u.ui.Close() }
+func (u *closingUI) onClose(f func())      { u.ui.onClose(f) }
+func (u *closingUI) Done() <-chan struct{} { return u.ui.Done() }
+
+func TestWindowGeometryTrackClose(t *testing.T) {
+	delay := geometrySaveDelay
+	geometrySaveDelay = time.Hour
+	defer func() { geometrySaveDelay = delay }()
+
+	c := newChromeState(Options{})
+	exited, done := make(chan struct{}), make(chan struct{})
+	c.exited, c.killProcess = exited, func() error { return nil }
+	close(exited)
+	u := &closingUI{trackedUI: &trackedUI{}, ui: &ui{chrome: c, done: done}}
+
+	g := &WindowGeometry{Path: filepath.Join(t.TempDir(), "window.json")}
+	if err := g.Track(u); err != nil {
+		t.Fatal(err)
+	}
+	u.events(WindowEvent{Type: WindowResized, Bounds: Bounds{Width: 800, Height: 600, WindowState: WindowStateNormal}})
+	close(done)
+	// Bounds are saved by the time Close returns
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := g.Load(); err != nil || b.Width != 800 {
+		t.Fatal(b, err)
+	}
+}
@@ -0,0 +1,643 @@
+package lorca
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR is an HTTP Archive 1.2 log of the page network traffic. It can be saved
+// into a .har file with WriteTo and opened by most browser developer tools.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of the HAR archive.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator describes the application that created the archive.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request-response pair.
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	ResourceType    string      `json:"_resourceType,omitempty"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+// HARRequest is a request as it was sent by the browser.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse is a response as it was received by the browser.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a header or a query parameter.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARCookie is a cookie sent with the request or set by the response.
+type HARCookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	HTTPOnly bool       `json:"httpOnly,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+}
+
+// HARPostData is a request body.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent is a response body. Text is only present if body capture was
+// enabled, binary bodies are base64-encoded.
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are durations of the request phases in milliseconds, -1 means
+// that the phase does not apply to the request.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// WriteTo writes the archive as JSON, which is the format of .har files.
+func (har *HAR) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// HAROptions configures HAR recording.
+type HAROptions struct {
+	// Bodies enables capturing of the response bodies.
+	Bodies bool
+	// MaxBodySize is the largest body size in bytes that is captured, larger
+	// bodies are omitted. Zero means no limit.
+	MaxBodySize int
+}
+
+type harRequest struct {
+	id        string
+	entry     HAREntry
+	timestamp float64 // monotonic time in seconds when the request was sent
+	timing    *resourceTiming
+	received  int
+}
+
+// resourceTiming is the Network.ResourceTiming, all fields but RequestTime are
+// milliseconds relative to RequestTime, which is in seconds.
+type resourceTiming struct {
+	RequestTime       float64 `json:"requestTime"`
+	DNSStart          float64 `json:"dnsStart"`
+	DNSEnd            float64 `json:"dnsEnd"`
+	ConnectStart      float64 `json:"connectStart"`
+	ConnectEnd        float64 `json:"connectEnd"`
+	SSLStart          float64 `json:"sslStart"`
+	SSLEnd            float64 `json:"sslEnd"`
+	SendStart         float64 `json:"sendStart"`
+	SendEnd           float64 `json:"sendEnd"`
+	ReceiveHeadersEnd float64 `json:"receiveHeadersEnd"`
+}
+
+type harResponse struct {
+	URL               string            `json:"url"`
+	Status            int               `json:"status"`
+	StatusText        string            `json:"statusText"`
+	Headers           map[string]string `json:"headers"`
+	MimeType          string            `json:"mimeType"`
+	Protocol          string            `json:"protocol"`
+	RemoteIPAddress   string            `json:"remoteIPAddress"`
+	EncodedDataLength int               `json:"encodedDataLength"`
+	Timing            *resourceTiming   `json:"timing"`
+}
+
+// harRecorder builds HAR entries from the Network domain events.
+type harRecorder struct {
+	sync.Mutex
+	opts     HAROptions
+	requests map[string]*harRequest
+	entries  []HAREntry
+	stopped  bool
+	bodies   sync.WaitGroup
+	// Raw headers from the ExtraInfo events, which include cookies, that
+	// arrived before the request or the response they belong to
+	requestHeaders  map[string]map[string]string
+	responseHeaders map[string]map[string]string
+	// getBody returns the response body and whether it's base64-encoded
+	getBody func(id string) (string, bool, error)
+}
+
+func newHARRecorder(opts HAROptions, getBody func(id string) (string, bool, error)) *harRecorder {
+	return &harRecorder{
+		opts:            opts,
+		requests:        map[string]*harRequest{},
+		requestHeaders:  map[string]map[string]string{},
+		responseHeaders: map[string]map[string]string{},
+		getBody:         getBody,
+	}
+}
+
+func (rec *harRecorder) requestWillBeSent(params json.RawMessage) {
+	ev := struct {
+		ID      string `json:"requestId"`
+		Request struct {
+			URL      string            `json:"url"`
+			Fragment string            `json:"urlFragment"`
+			Method   string            `json:"method"`
+			Headers  map[string]string `json:"headers"`
+			PostData string            `json:"postData"`
+		} `json:"request"`
+		Timestamp        float64      `json:"timestamp"`
+		WallTime         float64      `json:"wallTime"`
+		Type             string       `json:"type"`
+		RedirectResponse *harResponse `json:"redirectResponse"`
+	}{}
+	if json.Unmarshal(params, &ev) != nil {
+		return
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.stopped {
+		return
+	}
+	if r, ok := rec.requests[ev.ID]; ok && ev.RedirectResponse != nil {
+		rec.response(r, ev.RedirectResponse)
+		r.entry.Response.RedirectURL = ev.Request.URL
+		rec.finish(ev.ID, r, ev.Timestamp)
+	}
+	req := HARRequest{
+		Method:      ev.Request.Method,
+		URL:         ev.Request.URL + ev.Request.Fragment,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     requestCookies(ev.Request.Headers),
+		Headers:     harHeaders(ev.Request.Headers),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(ev.Request.PostData),
+	}
+	if u, err := url.Parse(ev.Request.URL); err == nil {
+		for name, values := range u.Query() {
+			for _, v := range values {
+				req.QueryString = append(req.QueryString, HARNameValue{Name: name, Value: v})
+			}
+		}
+		sort.SliceStable(req.QueryString, func(i, j int) bool { return req.QueryString[i].Name < req.QueryString[j].Name })
+	}
+	if ev.Request.PostData != "" {
+		req.PostData = &HARPostData{MimeType: headerValue(ev.Request.Headers, "Content-Type"), Text: ev.Request.PostData}
+	}
+	sec, frac := math.Modf(ev.WallTime)
+	r := &harRequest{
+		id:        ev.ID,
+		timestamp: ev.Timestamp,
+		entry: HAREntry{
+			StartedDateTime: time.Unix(int64(sec), int64(frac*1e9)).UTC(),
+			Request:         req,
+			Response: HARResponse{
+				Cookies:     []HARCookie{},
+				Headers:     []HARNameValue{},
+				HeadersSize: -1,
+				BodySize:    -1,
+			},
+			ResourceType: strings.ToLower(ev.Type),
+		},
+	}
+	rec.requests[ev.ID] = r
+	if headers, ok := rec.requestHeaders[ev.ID]; ok {
+		delete(rec.requestHeaders, ev.ID)
+		rec.rawRequestHeaders(r, headers)
+	}
+}
+
+// requestExtraInfo and responseExtraInfo handle the raw headers, which may
+// arrive before or after the request and the response.
+func (rec *harRecorder) requestExtraInfo(params json.RawMessage) {
+	ev := struct {
+		ID      string            `json:"requestId"`
+		Headers map[string]string `json:"headers"`
+	}{}
+	if json.Unmarshal(params, &ev) != nil {
+		return
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.stopped {
+		return
+	}
+	if r, ok := rec.requests[ev.ID]; ok {
+		rec.rawRequestHeaders(r, ev.Headers)
+	} else {
+		rec.requestHeaders[ev.ID] = ev.Headers
+	}
+}
+
+func (rec *harRecorder) responseExtraInfo(params json.RawMessage) {
+	ev := struct {
+		ID      string            `json:"requestId"`
+		Headers map[string]string `json:"headers"`
+	}{}
+	if json.Unmarshal(params, &ev) != nil {
+		return
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.stopped {
+		return
+	}
+	if r, ok := rec.requests[ev.ID]; ok && r.entry.Response.Status != 0 {
+		rec.rawResponseHeaders(r, ev.Headers)
+	} else {
+		rec.responseHeaders[ev.ID] = ev.Headers
+	}
+}
+
+func (rec *harRecorder) rawRequestHeaders(r *harRequest, headers map[string]string) {
+	r.entry.Request.Headers = harHeaders(headers)
+	r.entry.Request.Cookies = requestCookies(headers)
+}
+
+func (rec *harRecorder) rawResponseHeaders(r *harRequest, headers map[string]string) {
+	r.entry.Response.Headers = harHeaders(headers)
+	r.entry.Response.Cookies = responseCookies(headers)
+}
+
+func (rec *harRecorder) responseReceived(params json.RawMessage) {
+	ev := struct {
+		ID       string      `json:"requestId"`
+		Response harResponse `json:"response"`
+	}{}
+	if json.Unmarshal(params, &ev) != nil {
+		return
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.stopped {
+		return
+	}
+	if r, ok := rec.requests[ev.ID]; ok {
+		rec.response(r, &ev.Response)
+	}
+}
+
+func (rec *harRecorder) dataReceived(params json.RawMessage) {
+	ev := struct {
+		ID         string `json:"requestId"`
+		DataLength int    `json:"dataLength"`
+	}{}
+	if json.Unmarshal(params, &ev) != nil {
+		return
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.stopped {
+		return
+	}
+	if r, ok := rec.requests[ev.ID]; ok {
+		r.received += ev.DataLength
+	}
+}
+
+func (rec *harRecorder) loadingFinished(params json.RawMessage) {
+	ev := struct {
+		ID                string  `json:"requestId"`
+		Timestamp         float64 `json:"timestamp"`
+		EncodedDataLength int     `json:"encodedDataLength"`
+	}{}
+	if json.Unmarshal(params, &ev) != nil {
+		return
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.stopped {
+		return
+	}
+	if r, ok := rec.requests[ev.ID]; ok {
+		r.entry.Response.BodySize = ev.EncodedDataLength
+		rec.finish(ev.ID, r, ev.Timestamp)
+	}
+}
+
+func (rec *harRecorder) loadingFailed(params json.RawMessage) {
+	ev := struct {
+		ID        string  `json:"requestId"`
+		Timestamp float64 `json:"timestamp"`
+		ErrorText string  `json:"errorText"`
+	}{}
+	if json.Unmarshal(params, &ev) != nil {
+		return
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.stopped {
+		return
+	}
+	if r, ok := rec.requests[ev.ID]; ok {
+		r.entry.Error = ev.ErrorText
+		rec.finish(ev.ID, r, ev.Timestamp)
+	}
+}
+
+func (rec *harRecorder) response(r *harRequest, res *harResponse) {
+	r.timing = res.Timing
+	r.entry.ServerIPAddress = strings.Trim(res.RemoteIPAddress, "[]")
+	r.entry.Request.HTTPVersion = harProtocol(res.Protocol)
+	r.entry.Response.Status = res.Status
+	r.entry.Response.StatusText = res.StatusText
+	r.entry.Response.HTTPVersion = harProtocol(res.Protocol)
+	r.entry.Response.Headers = harHeaders(res.Headers)
+	r.entry.Response.Cookies = responseCookies(res.Headers)
+	r.entry.Response.RedirectURL = headerValue(res.Headers, "Location")
+	r.entry.Response.Content.MimeType = res.MimeType
+	if headers, ok := rec.responseHeaders[r.id]; ok {
+		delete(rec.responseHeaders, r.id)
+		rec.rawResponseHeaders(r, headers)
+	}
+}
+
+// finish moves the request into the list of complete entries, the body is
+// fetched asynchronously if needed.
+func (rec *harRecorder) finish(id string, r *harRequest, timestamp float64) {
+	delete(rec.requests, id)
+	r.entry.Timings, r.entry.Time = harTimings(r.timing, r.timestamp, timestamp)
+	r.entry.Response.Content.Size = r.received
+	rec.entries = append(rec.entries, r.entry)
+	status := r.entry.Response.Status
+	if !rec.opts.Bodies || r.entry.Error != "" || (status >= 300 && status < 400) || rec.getBody == nil {
+		return
+	}
+	i := len(rec.entries) - 1
+	rec.bodies.Add(1)
+	go func() {
+		defer rec.bodies.Done()
+		body, b64, err := rec.getBody(id)
+		rec.Lock()
+		defer rec.Unlock()
+		content := &rec.entries[i].Response.Content
+		if err != nil {
+			content.Comment = err.Error()
+			return
+		}
+		size := len(body)
+		if b64 {
+			size = base64.StdEncoding.DecodedLen(len(body))
+		}
+		if rec.opts.MaxBodySize > 0 && size > rec.opts.MaxBodySize {
+			content.Comment = "body exceeds size limit"
+			return
+		}
+		if !b64 && !utf8.ValidString(body) {
+			body, b64 = base64.StdEncoding.EncodeToString([]byte(body)), true
+		}
+		content.Text = body
+		if b64 {
+			content.Encoding = "base64"
+		}
+	}()
+}
+
+// har stops recording, waits for all pending bodies and returns the archive.
+// Requests that haven't finished yet are included without response bodies.
+func (rec *harRecorder) har() *HAR {
+	// No bodies are requested once stopped, so Wait doesn't race with Add
+	rec.Lock()
+	rec.stopped = true
+	rec.Unlock()
+	rec.bodies.Wait()
+	rec.Lock()
+	defer rec.Unlock()
+	entries := append([]HAREntry{}, rec.entries...)
+	for _, r := range rec.requests {
+		r.entry.Timings, r.entry.Time = harTimings(r.timing, r.timestamp, r.timestamp)
+		entries = append(entries, r.entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+	return &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "lorca", Version: "1"},
+		Entries: entries,
+	}}
+}
+
+// harTimings converts the resource timing into HAR timings and returns them
+// together with the total request time in milliseconds.
+func harTimings(t *resourceTiming, started, finished float64) (HARTimings, float64) {
+	total := math.Round(math.Max(0, (finished-started)*1000)*1000) / 1000
+	if t == nil {
+		return HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: total}, total
+	}
+	span := func(start, end float64) float64 {
+		if start < 0 || end < 0 {
+			return -1
+		}
+		return end - start
+	}
+	timings := HARTimings{
+		DNS:     span(t.DNSStart, t.DNSEnd),
+		Connect: span(t.ConnectStart, t.ConnectEnd),
+		SSL:     span(t.SSLStart, t.SSLEnd),
+		Send:    math.Max(0, t.SendEnd-t.SendStart),
+		Wait:    math.Max(0, t.ReceiveHeadersEnd-t.SendEnd),
+		Blocked: -1,
+	}
+	for _, start := range []float64{t.DNSStart, t.ConnectStart, t.SendStart} {
+		if start >= 0 {
+			timings.Blocked = start
+			break
+		}
+	}
+	end := math.Max(0, (finished-t.RequestTime)*1000)
+	timings.Receive = math.Round(math.Max(0, end-t.ReceiveHeadersEnd)*1000) / 1000
+	total = 0
+	for _, d := range []float64{timings.Blocked, timings.DNS, timings.Connect, timings.Send, timings.Wait, timings.Receive} {
+		if d > 0 {
+			total += d
+		}
+	}
+	return timings, total
+}
+
+func harHeaders(headers map[string]string) []HARNameValue {
+	fields := []HARNameValue{}
+	for name, value := range headers {
+		// Multiple header values are separated with newlines
+		for _, v := range strings.Split(value, "\n") {
+			fields = append(fields, HARNameValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// requestCookies parses the Cookie header.
+func requestCookies(headers map[string]string) []HARCookie {
+	cookies := []HARCookie{}
+	r := &http.Request{Header: http.Header{}}
+	for _, v := range strings.Split(headerValue(headers, "Cookie"), "\n") {
+		r.Header.Add("Cookie", v)
+	}
+	for _, c := range r.Cookies() {
+		cookies = append(cookies, HARCookie{Name: c.Name, Value: c.Value})
+	}
+	return cookies
+}
+
+// responseCookies parses the Set-Cookie headers, which are separated with
+// newlines.
+func responseCookies(headers map[string]string) []HARCookie {
+	cookies := []HARCookie{}
+	r := &http.Response{Header: http.Header{}}
+	for _, v := range strings.Split(headerValue(headers, "Set-Cookie"), "\n") {
+		r.Header.Add("Set-Cookie", v)
+	}
+	for _, c := range r.Cookies() {
+		cookie := HARCookie{Name: c.Name, Value: c.Value, Path: c.Path, Domain: c.Domain, HTTPOnly: c.HttpOnly, Secure: c.Secure}
+		if !c.Expires.IsZero() {
+			expires := c.Expires.UTC()
+			cookie.Expires = &expires
+		}
+		cookies = append(cookies, cookie)
+	}
+	return cookies
+}
+
+func headerValue(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+func harProtocol(protocol string) string {
+	switch strings.ToLower(protocol) {
+	case "h2":
+		return "HTTP/2.0"
+	case "h3", "http/3":
+		return "HTTP/3"
+	case "":
+		return "HTTP/1.1"
+	}
+	return strings.ToUpper(protocol)
+}
+
+// startHAR starts recording network traffic into a HAR archive.
+func (c *chrome) startHAR(opts HAROptions) error {
+	rec := newHARRecorder(opts, func(id string) (string, bool, error) {
+		res, err := c.send("Network.getResponseBody", h{"requestId": id})
+		if err != nil {
+			return "", false, err
+		}
+		body := struct {
+			Body          string `json:"body"`
+			Base64Encoded bool   `json:"base64Encoded"`
+		}{}
+		err = json.Unmarshal(res, &body)
+		return body.Body, body.Base64Encoded, err
+	})
+	c.Lock()
+	if c.har != nil {
+		c.Unlock()
+		return errors.New("HAR recording is already started")
+	}
+	first := !c.harEnabled
+	c.har, c.harEnabled = rec, true
+	c.Unlock()
+	if first {
+		for method, f := range map[string]func(*harRecorder, json.RawMessage){
+			"Network.requestWillBeSent":          (*harRecorder).requestWillBeSent,
+			"Network.responseReceived":           (*harRecorder).responseReceived,
+			"Network.dataReceived":               (*harRecorder).dataReceived,
+			"Network.loadingFinished":            (*harRecorder).loadingFinished,
+			"Network.loadingFailed":              (*harRecorder).loadingFailed,
+			"Network.requestWillBeSentExtraInfo": (*harRecorder).requestExtraInfo,
+			"Network.responseReceivedExtraInfo":  (*harRecorder).responseExtraInfo,
+		} {
+			f := f
+			c.on(method, func(params json.RawMessage) {
+				c.Lock()
+				rec := c.har
+				c.Unlock()
+				if rec != nil {
+					f(rec, params)
+				}
+			})
+		}
+	}
+	return nil
+}
+
+// stopHAR stops recording and returns the recorded archive.
+func (c *chrome) stopHAR() (*HAR, error) {
+	c.Lock()
+	rec := c.har
+	c.har = nil
+	c.Unlock()
+	if rec == nil {
+		return nil, errors.New("HAR recording is not started")
+	}
+	return rec.har(), nil
+}
@@ -0,0 +1,97 @@
+package lorca
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestHARRecorder(t *testing.T) {
+	rec := newHARRecorder(HAROptions{Bodies: true, MaxBodySize: 10}, func(id string) (string, bool, error) {
+		switch id {
+		case "1":
+			return "hello", false, nil
+		case "2":
+			return "this body is too long", false, nil
+		}
+		return "", false, errors.New("no body")
+	})
+
+	// Raw headers may arrive before the request
+	rec.requestExtraInfo(json.RawMessage(`{"requestId":"1","headers":{"Accept":"*/*","Cookie":"sid=42; theme=dark"}}`))
+	rec.requestWillBeSent(json.RawMessage(`{"requestId":"1","timestamp":100,"wallTime":1577836800.5,"type":"Document",
+		"request":{"url":"https://example.com/?b=2&a=1","method":"GET","headers":{"Accept":"*/*"}}}`))
+	rec.responseReceived(json.RawMessage(`{"requestId":"1","response":{"status":200,"statusText":"OK","protocol":"h2",
+		"headers":{"Content-Type":"text/plain","Set-Cookie":"a=1; Path=/; HttpOnly\nb=2; Secure"},"mimeType":"text/plain","remoteIPAddress":"[::1]",
+		"timing":{"requestTime":100,"dnsStart":1,"dnsEnd":3,"connectStart":3,"connectEnd":8,"sslStart":5,"sslEnd":8,
+		"sendStart":8,"sendEnd":9,"receiveHeadersEnd":20}}}`))
+	rec.dataReceived(json.RawMessage(`{"requestId":"1","dataLength":5}`))
+	rec.loadingFinished(json.RawMessage(`{"requestId":"1","timestamp":100.025,"encodedDataLength":100}`))
+
+	rec.requestWillBeSent(json.RawMessage(`{"requestId":"2","timestamp":101,"wallTime":1577836801,
+		"request":{"url":"http://example.com/post","method":"POST","postData":"x=1","headers":{"Content-Type":"application/x-www-form-urlencoded"}}}`))
+	rec.requestWillBeSent(json.RawMessage(`{"requestId":"2","timestamp":101.01,"wallTime":1577836801.01,
+		"request":{"url":"https://example.com/post","method":"GET","headers":{}},
+		"redirectResponse":{"status":301,"statusText":"Moved","headers":{"Location":"https://example.com/post"}}}`))
+	rec.responseReceived(json.RawMessage(`{"requestId":"2","response":{"status":200,"headers":{},"mimeType":"text/html"}}`))
+	rec.loadingFinished(json.RawMessage(`{"requestId":"2","timestamp":101.02,"encodedDataLength":30}`))
+
+	rec.requestWillBeSent(json.RawMessage(`{"requestId":"3","timestamp":102,"wallTime":1577836802,"request":{"url":"https://example.com/x","method":"GET"}}`))
+	rec.loadingFailed(json.RawMessage(`{"requestId":"3","timestamp":102.5,"errorText":"net::ERR_FAILED"}`))
+
+	har := rec.har()
+	entries := har.Log.Entries
+	if har.Log.Version != "1.2" || len(entries) != 4 {
+		t.Fatal(har)
+	}
+
+	e := entries[0]
+	if e.Request.URL != "https://example.com/?b=2&a=1" || len(e.Request.QueryString) != 2 || e.Request.QueryString[0].Name != "a" {
+		t.Fatal(e.Request)
+	}
+	if e.StartedDateTime.UnixNano() != 1577836800500000000 || e.ServerIPAddress != "::1" || e.ResourceType != "document" {
+		t.Fatal(e)
+	}
+	if c := e.Request.Cookies; len(c) != 2 || c[0].Name != "sid" || c[0].Value != "42" || c[1].Name != "theme" {
+		t.Fatal(c)
+	}
+	if c := e.Response.Cookies; len(c) != 2 || c[0].Name != "a" || c[0].Path != "/" || !c[0].HTTPOnly || !c[1].Secure {
+		t.Fatal(c)
+	}
+	if e.Response.Status != 200 || e.Response.HTTPVersion != "HTTP/2.0" || len(e.Response.Headers) != 3 || e.Response.BodySize != 100 {
+		t.Fatal(e.Response)
+	}
+	if c := e.Response.Content; c.Text != "hello" || c.Size != 5 || c.MimeType != "text/plain" {
+		t.Fatal(c)
+	}
+	if tm := e.Timings; tm.Blocked != 1 || tm.DNS != 2 || tm.Connect != 5 || tm.SSL != 3 || tm.Send != 1 || tm.Wait != 11 || tm.Receive != 5 || e.Time != 25 {
+		t.Fatal(tm, e.Time)
+	}
+
+	if e := entries[1]; e.Response.Status != 301 || e.Response.RedirectURL != "https://example.com/post" || e.Request.PostData.Text != "x=1" || e.Response.Content.Text != "" {
+		t.Fatal(e)
+	}
+	if e := entries[2]; e.Response.Status != 200 || e.Response.Content.Text != "" || e.Response.Content.Comment != "body exceeds size limit" {
+		t.Fatal(e)
+	}
+	if e := entries[3]; e.Error != "net::ERR_FAILED" || e.Time != 500 {
+		t.Fatal(e)
+	}
+
+	// Events after the recording has stopped are ignored
+	rec.requestWillBeSent(json.RawMessage(`{"requestId":"4","timestamp":103,"wallTime":1577836803,"request":{"url":"https://example.com/","method":"GET"}}`))
+	rec.loadingFinished(json.RawMessage(`{"requestId":"4","timestamp":103.5,"encodedDataLength":1}`))
+	if n := len(rec.har().Log.Entries); n != 4 {
+		t.Fatal(n)
+	}
+
+	b := &bytes.Buffer{}
+	if _, err := har.WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+	parsed := &HAR{}
+	if err := json.Unmarshal(b.Bytes(), parsed); err != nil || len(parsed.Log.Entries) != 4 {
+		t.Fatal(err, b.String())
+	}
+}
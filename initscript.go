@@ -0,0 +1,108 @@
+package lorca
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+type initScript struct {
+	id         string
+	source     string
+	identifier string // assigned by Page.addScriptToEvaluateOnNewDocument
+	styleSheet bool   // added by AddStyleSheet, removed by RemoveStyleSheet
+}
+
+// addInitScript registers JS code to be evaluated in every new document before
+// any of the page scripts. If now is true, the code is also evaluated in the
+// current document.
+func (c *chrome) addInitScript(source string, now bool) (string, error) {
+	id := strconv.Itoa(int(atomic.AddInt32(&c.scriptID, 1)))
+	return id, c.addScript(id, source, false, now)
+}
+
+func (c *chrome) addScript(id, source string, styleSheet, now bool) error {
+	res, err := c.send("Page.addScriptToEvaluateOnNewDocument", h{"source": source})
+	if err != nil {
+		return err
+	}
+	script := &initScript{id: id, source: source, styleSheet: styleSheet}
+	if err := json.Unmarshal(res, &struct {
+		Identifier *string `json:"identifier"`
+	}{&script.identifier}); err != nil {
+		return err
+	}
+	c.Lock()
+	c.scripts = append(c.scripts, script)
+	c.Unlock()
+	if now {
+		_, err = c.eval(source)
+	}
+	return err
+}
+
+func (c *chrome) removeInitScript(id string) error {
+	return c.removeScript(id, false)
+}
+
+// removeScript removes an init script or a stylesheet, IDs of one kind are not
+// accepted for the other one.
+func (c *chrome) removeScript(id string, styleSheet bool) error {
+	c.Lock()
+	var script *initScript
+	for i, s := range c.scripts {
+		if s.id == id && s.styleSheet == styleSheet {
+			script = s
+			c.scripts = append(c.scripts[:i], c.scripts[i+1:]...)
+			break
+		}
+	}
+	c.Unlock()
+	if script == nil && styleSheet {
+		return errors.New("stylesheet not found: " + id)
+	} else if script == nil {
+		return errors.New("init script not found: " + id)
+	}
+	_, err := c.send("Page.removeScriptToEvaluateOnNewDocument", h{"identifier": script.identifier})
+	return err
+}
+
+// Constructable stylesheets are adopted by the document, so they can be added
+// before the document element exists. Each stylesheet is stored by its ID to
+// be found and removed later.
+const styleSheetScript = `(() => {
+	const key = Symbol.for('lorca.stylesheets');
+	const sheets = document[key] || (document[key] = new Map());
+	const sheet = new CSSStyleSheet();
+	sheet.replaceSync(%[2]s);
+	sheets.set(%[1]q, sheet);
+	document.adoptedStyleSheets = [...document.adoptedStyleSheets, sheet];
+})()`
+
+const removeStyleSheetScript = `(() => {
+	const sheets = document[Symbol.for('lorca.stylesheets')];
+	const sheet = sheets && sheets.get(%[1]q);
+	if (sheet) {
+		document.adoptedStyleSheets = document.adoptedStyleSheets.filter(s => s !== sheet);
+		sheets.delete(%[1]q);
+	}
+})()`
+
+func (c *chrome) addStyleSheet(css string, now bool) (string, error) {
+	b, err := json.Marshal(css)
+	if err != nil {
+		return "", err
+	}
+	id := strconv.Itoa(int(atomic.AddInt32(&c.scriptID, 1)))
+	return id, c.addScript(id, fmt.Sprintf(styleSheetScript, id, b), true, now)
+}
+
+func (c *chrome) removeStyleSheet(id string) error {
+	if err := c.removeScript(id, true); err != nil {
+		return err
+	}
+	_, err := c.eval(fmt.Sprintf(removeStyleSheetScript, id))
+	return err
+}
@@ -0,0 +1,404 @@
+package lorca
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// InterceptedRequest is a network request paused before it's sent. Handler
+// may modify URL, Method, Header and Body and continue the request, fail it,
+// or fulfill it with a custom response. If the handler returns without doing
+// either of that, the request is continued with all the modifications applied.
+type InterceptedRequest struct {
+	URL          string
+	Method       string
+	Header       http.Header
+	Body         []byte
+	ResourceType string
+
+	mu      sync.Mutex
+	chrome  *chrome
+	paused  *requestPaused
+	handled bool
+}
+
+// Continue sends the request to the network, with the modifications made to
+// URL, Method, Header or Body.
+func (r *InterceptedRequest) Continue() error {
+	if !r.handle() {
+		return errRequestHandled
+	}
+	params := h{"requestId": r.paused.ID}
+	orig := newInterceptedRequest(nil, r.paused)
+	if r.URL != orig.URL {
+		params["url"] = r.URL
+	}
+	if r.Method != orig.Method {
+		params["method"] = r.Method
+	}
+	if string(r.Body) != string(orig.Body) {
+		params["postData"] = r.Body
+	}
+	if !reflect.DeepEqual(r.Header, orig.Header) {
+		params["headers"] = headerEntries(r.Header)
+	}
+	_, err := r.chrome.send("Fetch.continueRequest", params)
+	return err
+}
+
+// Fail aborts the request with the given network error reason, e.g. "Failed",
+// "Aborted", "AccessDenied" or "BlockedByClient". Empty reason means "Failed".
+func (r *InterceptedRequest) Fail(reason string) error {
+	if !r.handle() {
+		return errRequestHandled
+	}
+	if reason == "" {
+		reason = "Failed"
+	}
+	_, err := r.chrome.send("Fetch.failRequest", h{"requestId": r.paused.ID, "errorReason": reason})
+	return err
+}
+
+// Fulfill responds to the request with the given status, headers and body
+// without sending it to the network.
+func (r *InterceptedRequest) Fulfill(status int, header http.Header, body []byte) error {
+	if !r.handle() {
+		return errRequestHandled
+	}
+	return r.chrome.fulfill(r.paused, status, header, body)
+}
+
+// handle marks request as handled, it returns false if the request has been
+// already handled before.
+func (r *InterceptedRequest) handle() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	handled := r.handled
+	r.handled = true
+	return !handled
+}
+
+func newInterceptedRequest(c *chrome, p *requestPaused) *InterceptedRequest {
+	r := &InterceptedRequest{
+		URL:          p.Request.URL + p.Request.Fragment,
+		Method:       p.Request.Method,
+		Header:       http.Header{},
+		Body:         p.body(),
+		ResourceType: p.ResourceType,
+		chrome:       c,
+		paused:       p,
+	}
+	for k, v := range p.Request.Headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+// AuthChallenge is an HTTP authentication request from a server or a proxy.
+type AuthChallenge struct {
+	URL    string `json:"-"`
+	Source string `json:"source"`
+	Origin string `json:"origin"`
+	Scheme string `json:"scheme"`
+	Realm  string `json:"realm"`
+}
+
+// NetworkPolicy restricts the origins the page may send requests to.
+// Requests to other origins are failed with "BlockedByClient" before they
+// reach the network. Origins served with UI.Handle are always allowed. Only
+// requests visible to the Fetch domain are checked, i.e. data: and blob: URLs
+// never are. Neither are WebSocket connections and requests made by service
+// workers, which don't pass through the Fetch domain of the page.
+type NetworkPolicy struct {
+	// AllowedOrigins is a list of origins, e.g. "https://example.com". URLs
+	// without a host, e.g. file: URLs, can't be allowed.
+	AllowedOrigins []string
+	// OnBlocked, if not nil, is called for every blocked request.
+	OnBlocked func(r *InterceptedRequest)
+}
+
+// validate returns an error if any of the allowed origins is not a URL with
+// a host, as it would never match.
+func (p *NetworkPolicy) validate() error {
+	for _, o := range p.AllowedOrigins {
+		if urlOrigin(o) == "" {
+			return fmt.Errorf("invalid allowed origin: %q", o)
+		}
+	}
+	return nil
+}
+
+func (p *NetworkPolicy) allows(rawurl string, served []string) bool {
+	origin := urlOrigin(rawurl)
+	if origin == "" {
+		return false
+	}
+	for _, origins := range [][]string{served, p.AllowedOrigins} {
+		for _, o := range origins {
+			if urlOrigin(o) == origin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// urlOrigin returns the normalized origin (scheme://host:port) of the URL.
+func urlOrigin(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	origin := strings.ToLower(u.Scheme + "://" + u.Hostname())
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		origin = origin + ":" + port
+	}
+	return origin
+}
+
+func headerEntries(header http.Header) []h {
+	entries := []h{}
+	for name, values := range header {
+		for _, v := range values {
+			entries = append(entries, h{"name": name, "value": v})
+		}
+	}
+	return entries
+}
+
+// requestPaused is a request paused by the Fetch domain.
+type requestPaused struct {
+	ID      string `json:"requestId"`
+	Request struct {
+		URL             string            `json:"url"`
+		Fragment        string            `json:"urlFragment"`
+		Method          string            `json:"method"`
+		Headers         map[string]string `json:"headers"`
+		PostData        string            `json:"postData"`
+		HasPostData     bool              `json:"hasPostData"`
+		PostDataEntries []struct {
+			Bytes string `json:"bytes"`
+		} `json:"postDataEntries"`
+	} `json:"request"`
+	ResourceType string `json:"resourceType"`
+}
+
+// body returns the decoded request body, if any.
+func (p *requestPaused) body() []byte {
+	if len(p.Request.PostDataEntries) == 0 {
+		return []byte(p.Request.PostData)
+	}
+	body := []byte{}
+	for _, e := range p.Request.PostDataEntries {
+		b, _ := base64.StdEncoding.DecodeString(e.Bytes)
+		body = append(body, b...)
+	}
+	return body
+}
+
+type fetchRoute struct {
+	pattern string
+	handler func(p *requestPaused)
+}
+
+// route intercepts requests with URLs matching the pattern. Patterns may
+// contain wildcards: '*' matches zero or more characters, '?' matches exactly
+// one. The first matching route handles the request, unmatched requests are
+// continued as is.
+func (c *chrome) route(pattern string, f func(p *requestPaused)) error {
+	c.Lock()
+	c.routes = append(c.routes, fetchRoute{pattern: pattern, handler: f})
+	c.Unlock()
+	return c.enableFetch()
+}
+
+// intercept calls f for every request with URL matching the pattern.
+func (c *chrome) intercept(pattern string, f func(r *InterceptedRequest)) error {
+	return c.route(pattern, func(p *requestPaused) {
+		r := newInterceptedRequest(c, p)
+		f(r)
+		r.Continue()
+	})
+}
+
+// setAuthHandler sets a function that answers authentication challenges. If
+// it returns false the authentication is cancelled.
+func (c *chrome) setAuthHandler(f func(AuthChallenge) (user, password string, ok bool)) error {
+	c.Lock()
+	c.auth = f
+	c.Unlock()
+	return c.enableFetch()
+}
+
+func (c *chrome) setNetworkPolicy(p *NetworkPolicy) error {
+	if p != nil {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	c.Lock()
+	c.policy = p
+	c.Unlock()
+	return c.enableFetch()
+}
+
+func (c *chrome) handlePaused(p *requestPaused) {
+	c.Lock()
+	routes, policy, served := c.routes, c.policy, c.served
+	c.Unlock()
+	if policy != nil && !policy.allows(p.Request.URL, served) {
+		r := newInterceptedRequest(c, p)
+		r.Fail("BlockedByClient")
+		if policy.OnBlocked != nil {
+			policy.OnBlocked(r)
+		}
+		return
+	}
+	for _, r := range routes {
+		if matchURLPattern(r.pattern, p.Request.URL) {
+			c.loadPostData(p)
+			r.handler(p)
+			return
+		}
+	}
+	c.send("Fetch.continueRequest", h{"requestId": p.ID})
+}
+
+// loadPostData fetches the request body that is too large to be included
+// into Fetch.requestPaused.
+func (c *chrome) loadPostData(p *requestPaused) {
+	if !p.Request.HasPostData || p.Request.PostData != "" || len(p.Request.PostDataEntries) > 0 {
+		return
+	}
+	res, err := c.send("Fetch.getRequestPostData", h{"requestId": p.ID})
+	if err != nil {
+		return
+	}
+	data := struct {
+		PostData      string `json:"postData"`
+		Base64Encoded bool   `json:"base64Encoded"`
+	}{}
+	json.Unmarshal(res, &data)
+	if data.Base64Encoded {
+		if b, err := base64.StdEncoding.DecodeString(data.PostData); err == nil {
+			data.PostData = string(b)
+		}
+	}
+	p.Request.PostData = data.PostData
+}
+
+var errRequestHandled = errors.New("request has been already handled")
+
+// enableFetch (re-)enables the Fetch domain with the patterns of all routes,
+// as each call to Fetch.enable replaces the previous patterns. Authentication
+// handler and network policy need all requests to be paused.
+func (c *chrome) enableFetch() error {
+	c.Lock()
+	patterns := []h{}
+	for _, r := range c.routes {
+		patterns = append(patterns, h{"urlPattern": r.pattern, "requestStage": "Request"})
+	}
+	if c.auth != nil || c.policy != nil {
+		patterns = []h{{"urlPattern": "*", "requestStage": "Request"}}
+	}
+	auth := c.auth != nil
+	first := !c.fetchEnabled
+	c.fetchEnabled = true
+	c.Unlock()
+	if first {
+		c.on("Fetch.requestPaused", func(params json.RawMessage) {
+			p := &requestPaused{}
+			if err := json.Unmarshal(params, p); err == nil {
+				go c.handlePaused(p)
+			}
+		})
+		c.on("Fetch.authRequired", func(params json.RawMessage) {
+			ev := struct {
+				ID      string `json:"requestId"`
+				Request struct {
+					URL string `json:"url"`
+				} `json:"request"`
+				Challenge AuthChallenge `json:"authChallenge"`
+			}{}
+			if err := json.Unmarshal(params, &ev); err == nil {
+				ev.Challenge.URL = ev.Request.URL
+				go c.handleAuth(ev.ID, ev.Challenge)
+			}
+		})
+	}
+	if len(patterns) == 0 {
+		_, err := c.send("Fetch.disable", nil)
+		return err
+	}
+	_, err := c.send("Fetch.enable", h{"patterns": patterns, "handleAuthRequests": auth})
+	return err
+}
+
+func (c *chrome) handleAuth(id string, challenge AuthChallenge) {
+	c.Lock()
+	auth := c.auth
+	c.Unlock()
+	response := h{"response": "Default"}
+	if auth != nil {
+		if user, password, ok := auth(challenge); ok {
+			response = h{"response": "ProvideCredentials", "username": user, "password": password}
+		} else {
+			response = h{"response": "CancelAuth"}
+		}
+	}
+	c.send("Fetch.continueWithAuth", h{"requestId": id, "authChallengeResponse": response})
+}
+
+// fulfill responds to the paused request with the given status, headers and
+// body, without sending it to the network.
+func (c *chrome) fulfill(p *requestPaused, status int, headers http.Header, body []byte) error {
+	params := h{"requestId": p.ID, "responseCode": status, "responseHeaders": headerEntries(headers)}
+	if body != nil {
+		params["body"] = body
+	}
+	_, err := c.send("Fetch.fulfillRequest", params)
+	return err
+}
+
+// matchURLPattern reports whether the URL matches the pattern as defined by
+// the Fetch domain: '*' matches zero or more characters, '?' matches exactly
+// one character, backslash escapes the following character.
+func matchURLPattern(pattern, url string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(url); i++ {
+				if matchURLPattern(pattern, url[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if url == "" {
+				return false
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if url == "" || url[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, url = pattern[1:], url[1:]
+	}
+	return url == ""
+}
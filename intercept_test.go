@@ -0,0 +1,92 @@
+package lorca
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMatchURLPattern(t *testing.T) {
+	for _, test := range []struct {
+		Pattern string
+		URL     string
+		Match   bool
+	}{
+		{Pattern: "*", URL: "https://example.com/", Match: true},
+		{Pattern: "https://app.lorca/*", URL: "https://app.lorca/", Match: true},
+		{Pattern: "https://app.lorca/*", URL: "https://app.lorca/js/app.js?v=1", Match: true},
+		{Pattern: "https://app.lorca/*", URL: "https://app.lorca.com/", Match: false},
+		{Pattern: "*.png", URL: "http://x/a.png", Match: true},
+		{Pattern: "*.png", URL: "http://x/a.png?x", Match: false},
+		{Pattern: "http://?/*", URL: "http://x/a", Match: true},
+		{Pattern: "http://?/*", URL: "http://xy/a", Match: false},
+		{Pattern: `http://x/\*`, URL: "http://x/*", Match: true},
+		{Pattern: `http://x/\*`, URL: "http://x/a", Match: false},
+		{Pattern: "", URL: "", Match: true},
+	} {
+		if m := matchURLPattern(test.Pattern, test.URL); m != test.Match {
+			t.Error(test.Pattern, test.URL, m)
+		}
+	}
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	p := &NetworkPolicy{AllowedOrigins: []string{"https://Example.com/", "http://localhost:8080"}}
+	served := []string{"https://app.lorca/"}
+	for _, test := range []struct {
+		URL     string
+		Allowed bool
+	}{
+		{URL: "https://example.com/foo?bar", Allowed: true},
+		{URL: "https://example.com:443/", Allowed: true},
+		{URL: "http://example.com/", Allowed: false},
+		{URL: "https://example.com.evil/", Allowed: false},
+		{URL: "http://localhost:8080/api", Allowed: true},
+		{URL: "http://localhost/api", Allowed: false},
+		{URL: "https://app.lorca/index.html", Allowed: true},
+		{URL: "not a url", Allowed: false},
+		{URL: "file:///etc/passwd", Allowed: false},
+	} {
+		if allowed := p.allows(test.URL, served); allowed != test.Allowed {
+			t.Error(test.URL, allowed)
+		}
+	}
+
+	// Malformed origins never match URLs without a host
+	p = &NetworkPolicy{AllowedOrigins: []string{"example.com"}}
+	if p.allows("file:///etc/passwd", nil) || p.allows("about:blank", nil) {
+		t.Error("URL without a host is allowed")
+	}
+	if err := p.validate(); err == nil {
+		t.Error("malformed origin accepted")
+	}
+}
+
+func TestIntercept(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	if err := ui.Intercept("https://api.lorca/*", func(r *InterceptedRequest) {
+		r.Fulfill(200, http.Header{"Access-Control-Allow-Origin": {"*"}}, []byte(r.Method+" "+r.URL))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if s := ui.Eval(`fetch('https://api.lorca/hello').then(r => r.text())`).String(); s != "GET https://api.lorca/hello" {
+		t.Fatal(s)
+	}
+
+	blocked := make(chan string, 1)
+	if err := ui.SetNetworkPolicy(&NetworkPolicy{
+		OnBlocked: func(r *InterceptedRequest) { blocked <- r.URL },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.Eval(`fetch('https://example.com/')`).Err(); err == nil {
+		t.Fatal("request is not blocked")
+	}
+	if url := <-blocked; url != "https://example.com/" {
+		t.Fatal(url)
+	}
+}
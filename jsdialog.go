@@ -0,0 +1,96 @@
+package lorca
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/zserge/lorca/dialog"
+)
+
+// JSDialogType defines the type of a JavaScript dialog, possible values are
+// "alert", "confirm", "prompt" and "beforeunload".
+type JSDialogType string
+
+const (
+	// JSDialogAlert defines a dialog opened with alert()
+	JSDialogAlert JSDialogType = "alert"
+	// JSDialogConfirm defines a dialog opened with confirm()
+	JSDialogConfirm JSDialogType = "confirm"
+	// JSDialogPrompt defines a dialog opened with prompt()
+	JSDialogPrompt JSDialogType = "prompt"
+	// JSDialogBeforeUnload defines a dialog asking to confirm leaving the page
+	JSDialogBeforeUnload JSDialogType = "beforeunload"
+)
+
+// JSDialog is a JavaScript dialog opened by the page.
+type JSDialog struct {
+	Type          JSDialogType `json:"type"`
+	Message       string       `json:"message"`
+	DefaultPrompt string       `json:"defaultPrompt"`
+	URL           string       `json:"url"`
+}
+
+// HeadlessJSDialogs is the default JavaScript dialog handler in headless mode,
+// where the browser can't show dialogs. It accepts alerts and beforeunload
+// dialogs, and dismisses confirmations and prompts.
+func HeadlessJSDialogs(d JSDialog) (accept bool, text string) {
+	return d.Type == JSDialogAlert || d.Type == JSDialogBeforeUnload, ""
+}
+
+// NativeJSDialogs shows JavaScript dialogs with the native OS dialogs. If no
+// dialog can be shown it falls back to HeadlessJSDialogs.
+func NativeJSDialogs(d JSDialog) (accept bool, text string) {
+	var err error
+	title := d.URL
+	if i := strings.Index(title, "://"); i >= 0 && !strings.HasPrefix(title, "data:") {
+		title = strings.SplitN(title[i+3:], "/", 2)[0]
+	} else {
+		title = ""
+	}
+	switch d.Type {
+	case JSDialogAlert:
+		err, accept = dialog.Info(title, d.Message), true
+	case JSDialogConfirm:
+		accept, err = dialog.Confirm(title, d.Message)
+	case JSDialogPrompt:
+		text, accept, err = dialog.Input(title, d.Message, d.DefaultPrompt)
+	case JSDialogBeforeUnload:
+		accept, err = dialog.Confirm(title, "Leave this page? Changes you made may not be saved.")
+	}
+	if err != nil {
+		return HeadlessJSDialogs(d)
+	}
+	return accept, text
+}
+
+// onJavaScriptDialog sets a function that handles JavaScript dialogs. In
+// headless mode nil function restores HeadlessJSDialogs, otherwise it lets
+// the browser show the dialogs.
+func (c *chrome) onJavaScriptDialog(f func(JSDialog) (bool, string)) error {
+	c.Lock()
+	if f == nil && c.headless {
+		f = HeadlessJSDialogs
+	}
+	first := !c.jsDialogEnabled
+	c.jsDialog, c.jsDialogEnabled = f, true
+	c.Unlock()
+	if !first {
+		return nil
+	}
+	c.on("Page.javascriptDialogOpening", func(params json.RawMessage) {
+		d := JSDialog{}
+		json.Unmarshal(params, &d)
+		c.Lock()
+		f := c.jsDialog
+		c.Unlock()
+		if f != nil {
+			go func() {
+				accept, text := f(d)
+				c.send("Page.handleJavaScriptDialog", h{"accept": accept, "promptText": text})
+			}()
+		}
+	})
+	// Dialog events are only sent with the Page domain enabled
+	_, err := c.send("Page.enable", nil)
+	return err
+}
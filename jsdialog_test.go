@@ -0,0 +1,30 @@
+package lorca
+
+import "testing"
+
+func TestJavaScriptDialog(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	// Default headless policy must not block the page
+	if v := ui.Eval(`alert('hello'), confirm('sure?')`); v.Err() != nil || v.Bool() {
+		t.Fatal(v)
+	}
+
+	dialogs := make(chan JSDialog, 1)
+	if err := ui.OnJavaScriptDialog(func(d JSDialog) (bool, string) {
+		dialogs <- d
+		return true, "Go"
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if s := ui.Eval(`prompt('Your name?', 'JS')`).String(); s != "Go" {
+		t.Fatal(s)
+	}
+	if d := <-dialogs; d.Type != JSDialogPrompt || d.Message != "Your name?" || d.DefaultPrompt != "JS" {
+		t.Fatal(d)
+	}
+}
@@ -1,78 +1,371 @@
 package lorca
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/zserge/lorca/dialog"
 )
 
 // ChromeExecutable returns a string which points to the preferred Chrome
 // executable file.
 var ChromeExecutable = LocateChrome
 
-// LocateChrome returns a path to the Chrome binary, or an empty string if
-// Chrome installation is not found.
+// ErrBrowserNotFound is returned when no suitable browser is installed. The
+// actual error is a *BrowserNotFoundError that matches it with errors.Is.
+var ErrBrowserNotFound = errors.New("browser not found")
+
+// BrowserNotFoundError tells where browsers were looked for and why none of
+// them was suitable.
+type BrowserNotFoundError struct {
+	// Searched are the paths where browser executables were looked for.
+	Searched []string
+	// Found are the installed browsers that were rejected by MinVersion.
+	Found []Browser
+	// MinVersion is the minimum major version that was required, if any.
+	MinVersion int
+}
+
+func (e *BrowserNotFoundError) Error() string {
+	if len(e.Found) > 0 {
+		return fmt.Sprintf("%v: %d browsers found, none of version %d or newer", ErrBrowserNotFound, len(e.Found), e.MinVersion)
+	}
+	return fmt.Sprintf("%v in %d locations", ErrBrowserNotFound, len(e.Searched))
+}
+
+// Is makes the error match ErrBrowserNotFound.
+func (e *BrowserNotFoundError) Is(target error) bool { return target == ErrBrowserNotFound }
+
+// Browser is an installed Chromium-based browser.
+type Browser struct {
+	// Path is the browser executable.
+	Path string
+	// Product is one of "Chrome", "Chromium", "Edge" or "Brave".
+	Product string
+	// Channel is one of "stable", "beta", "dev" or "canary".
+	Channel string
+	// Version is the browser version, e.g. "120.0.6099.109", or an empty
+	// string if it's unknown.
+	Version string
+}
+
+// Major returns the major version of the browser, or zero if the version is
+// unknown.
+func (b Browser) Major() int {
+	major, _ := strconv.Atoi(strings.SplitN(b.Version, ".", 2)[0])
+	return major
+}
+
+// BrowserPolicy selects one of the installed browsers.
+type BrowserPolicy struct {
+	// MinVersion is the minimum major version. Browsers of unknown version are
+	// accepted, their version is checked once they are started.
+	MinVersion int
+	// Products are the preferred products, in the order of preference. Other
+	// products are only used if none of the preferred ones is installed.
+	Products []string
+}
+
+// SelectBrowser returns the best installed browser according to the policy.
+// A browser from the LORCACHROME environment variable is always preferred.
+func SelectBrowser(p BrowserPolicy) (Browser, error) {
+	rank := func(b Browser) int {
+		for i, product := range p.Products {
+			if strings.EqualFold(product, b.Product) {
+				return i
+			}
+		}
+		return len(p.Products)
+	}
+	browsers := LocateBrowsers()
+	found := []Browser{}
+	for _, b := range browsers {
+		if p.MinVersion == 0 || b.Version == "" || b.Major() >= p.MinVersion {
+			found = append(found, b)
+		}
+	}
+	if len(found) == 0 {
+		return Browser{}, &BrowserNotFoundError{Searched: browserCandidates(), Found: browsers, MinVersion: p.MinVersion}
+	}
+	env, _ := os.LookupEnv("LORCACHROME")
+	sort.SliceStable(found, func(i, j int) bool {
+		if env != "" && (found[i].Path == env) != (found[j].Path == env) {
+			return found[i].Path == env
+		}
+		return rank(found[i]) < rank(found[j])
+	})
+	return found[0], nil
+}
+
+// LocateChrome returns a path to the browser that SelectBrowser prefers
+// without a policy, or an empty string if no browser is installed.
 func LocateChrome() string {
+	if b, err := SelectBrowser(BrowserPolicy{}); err == nil {
+		return b.Path
+	}
+	return ""
+}
 
-	// If env variable "LORCACHROME" specified and it exists
-	if path, ok := os.LookupEnv("LORCACHROME"); ok {
-		if _, err := os.Stat(path); err == nil {
-			return path
+// LocateBrowsers returns all installed Chromium-based browsers. The browser
+// from the LORCACHROME environment variable comes first, followed by stable
+// releases, then beta, dev and canary ones. Within a channel Chrome comes
+// first, then Chromium, Edge and Brave. Versions are detected by running the
+// browsers with "--version", or from the installation directory on Windows.
+func LocateBrowsers() []Browser {
+	browsers := []Browser{}
+	for _, path := range browserPaths() {
+		product, channel := classifyBrowser(path)
+		browsers = append(browsers, Browser{
+			Path:    path,
+			Product: product,
+			Channel: channel,
+			Version: browserVersion(path),
+		})
+	}
+	sortBrowsers(browsers, os.Getenv("LORCACHROME"))
+	return browsers
+}
+
+var (
+	channelOrder = []string{"stable", "beta", "dev", "canary"}
+	productOrder = []string{"Chrome", "Chromium", "Edge", "Brave"}
+)
+
+// sortBrowsers sorts the browsers by channel and product, keeping the browser
+// from the env path first.
+func sortBrowsers(browsers []Browser, env string) {
+	index := func(list []string, s string) int {
+		for i, x := range list {
+			if x == s {
+				return i
+			}
 		}
+		return len(list)
 	}
+	sort.SliceStable(browsers, func(i, j int) bool {
+		a, b := browsers[i], browsers[j]
+		if env != "" && (a.Path == env) != (b.Path == env) {
+			return a.Path == env
+		}
+		if ca, cb := index(channelOrder, a.Channel), index(channelOrder, b.Channel); ca != cb {
+			return ca < cb
+		}
+		return index(productOrder, a.Product) < index(productOrder, b.Product)
+	})
+}
 
+// browserPaths returns existing browser executables in the order of
+// preference, without duplicates.
+func browserPaths() []string {
+	found := []string{}
+	seen := map[string]bool{}
+	for _, path := range browserCandidates() {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			real = path
+		}
+		if !seen[real] {
+			seen[real] = true
+			found = append(found, path)
+		}
+	}
+	return found
+}
+
+// browserCandidates returns all the paths where browser executables are
+// looked for, in the order of preference.
+func browserCandidates() []string {
 	var paths []string
+	// If env variable "LORCACHROME" specified and it exists
+	if path, ok := os.LookupEnv("LORCACHROME"); ok {
+		paths = append(paths, path)
+	}
+
+	home, _ := os.UserHomeDir()
 	switch runtime.GOOS {
 	case "darwin":
-		paths = []string{
-			"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
-			"/Applications/Google Chrome Canary.app/Contents/MacOS/Google Chrome Canary",
-			"/Applications/Chromium.app/Contents/MacOS/Chromium",
-			"/Applications/Microsoft Edge.app/Contents/MacOS/Microsoft Edge",
+		for _, dir := range []string{"/Applications", filepath.Join(home, "Applications")} {
+			for _, app := range []string{
+				"Google Chrome",
+				"Google Chrome Beta",
+				"Google Chrome Dev",
+				"Google Chrome Canary",
+				"Chromium",
+				"Microsoft Edge",
+				"Microsoft Edge Beta",
+				"Microsoft Edge Dev",
+				"Microsoft Edge Canary",
+				"Brave Browser",
+			} {
+				paths = append(paths, filepath.Join(dir, app+".app", "Contents", "MacOS", app))
+			}
+		}
+		paths = append(paths,
 			"/usr/bin/google-chrome-stable",
 			"/usr/bin/google-chrome",
 			"/usr/bin/chromium",
 			"/usr/bin/chromium-browser",
-		}
+		)
 	case "windows":
-		paths = []string{
-			os.Getenv("LocalAppData") + "/Google/Chrome/Application/chrome.exe",
-			os.Getenv("ProgramFiles") + "/Google/Chrome/Application/chrome.exe",
-			os.Getenv("ProgramFiles(x86)") + "/Google/Chrome/Application/chrome.exe",
-			os.Getenv("LocalAppData") + "/Chromium/Application/chrome.exe",
-			os.Getenv("ProgramFiles") + "/Chromium/Application/chrome.exe",
-			os.Getenv("ProgramFiles(x86)") + "/Chromium/Application/chrome.exe",
-			os.Getenv("ProgramFiles(x86)") + "/Microsoft/Edge/Application/msedge.exe",
-			os.Getenv("ProgramFiles") + "/Microsoft/Edge/Application/msedge.exe",
+		for _, dir := range []string{os.Getenv("LocalAppData"), os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)")} {
+			if dir == "" {
+				continue
+			}
+			for _, exe := range []string{
+				"Google/Chrome/Application/chrome.exe",
+				"Google/Chrome Beta/Application/chrome.exe",
+				"Google/Chrome Dev/Application/chrome.exe",
+				"Google/Chrome SxS/Application/chrome.exe",
+				"Chromium/Application/chrome.exe",
+				"Microsoft/Edge/Application/msedge.exe",
+				"Microsoft/Edge Beta/Application/msedge.exe",
+				"Microsoft/Edge Dev/Application/msedge.exe",
+				"Microsoft/Edge SxS/Application/msedge.exe",
+				"BraveSoftware/Brave-Browser/Application/brave.exe",
+			} {
+				paths = append(paths, filepath.Join(dir, exe))
+			}
 		}
 	default:
-		paths = []string{
-			"/usr/bin/google-chrome-stable",
-			"/usr/bin/google-chrome",
-			"/usr/bin/chromium",
-			"/usr/bin/chromium-browser",
-			"/snap/bin/chromium",
+		names := []string{
+			"google-chrome-stable",
+			"google-chrome",
+			"google-chrome-beta",
+			"google-chrome-unstable",
+			"chromium",
+			"chromium-browser",
+			"microsoft-edge-stable",
+			"microsoft-edge",
+			"microsoft-edge-beta",
+			"microsoft-edge-dev",
+			"brave-browser",
+			"brave",
+		}
+		for _, name := range names {
+			if path, err := exec.LookPath(name); err == nil {
+				paths = append(paths, path)
+			}
+		}
+		for _, name := range names {
+			paths = append(paths,
+				filepath.Join("/usr/bin", name),
+				filepath.Join(home, ".local/bin", name),
+			)
+		}
+		paths = append(paths, "/snap/bin/chromium")
+		for _, dir := range []string{"/var/lib/flatpak/exports/bin", filepath.Join(home, ".local/share/flatpak/exports/bin")} {
+			for _, app := range []string{
+				"com.google.Chrome",
+				"com.google.ChromeDev",
+				"org.chromium.Chromium",
+				"com.microsoft.Edge",
+				"com.brave.Browser",
+			} {
+				paths = append(paths, filepath.Join(dir, app))
+			}
 		}
 	}
+	return paths
+}
 
-	for _, path := range paths {
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			continue
+// classifyBrowser guesses browser product and channel from its path.
+func classifyBrowser(path string) (product, channel string) {
+	name := strings.ToLower(filepath.Base(filepath.Dir(filepath.Dir(path))) + " " + filepath.Base(path))
+	switch {
+	case strings.Contains(name, "edge"):
+		product = "Edge"
+	case strings.Contains(name, "brave"):
+		product = "Brave"
+	case strings.Contains(name, "chromium"):
+		product = "Chromium"
+	default:
+		product = "Chrome"
+	}
+	switch {
+	case strings.Contains(name, "canary") || strings.Contains(name, "sxs"):
+		channel = "canary"
+	case strings.Contains(name, "beta"):
+		channel = "beta"
+	case strings.Contains(name, "dev") || strings.Contains(name, "unstable"):
+		channel = "dev"
+	default:
+		channel = "stable"
+	}
+	return product, channel
+}
+
+var versionRegexp = regexp.MustCompile(`\b\d+\.\d+\.\d+\.\d+\b`)
+
+// browserVersion returns the browser version, or an empty string if it can't
+// be detected. On Windows the browser can't print its version, but it's
+// installed into a subdirectory named after the version.
+func browserVersion(path string) string {
+	if runtime.GOOS == "windows" {
+		entries, err := os.ReadDir(filepath.Dir(path))
+		if err != nil {
+			return ""
 		}
-		return path
+		version := ""
+		for _, e := range entries {
+			if e.IsDir() && versionRegexp.MatchString(e.Name()) && compareVersions(e.Name(), version) > 0 {
+				version = e.Name()
+			}
+		}
+		return version
 	}
-	return ""
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	return versionRegexp.FindString(string(out))
+}
+
+// compareVersions compares dotted version numbers, an empty version is older
+// than any other.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
 }
 
 // PromptDownload asks user if he wants to download and install Chrome, and
-// opens a download web page if the user agrees.
+// opens a download web page if the user agrees. See package lorca/fetch for
+// installing a browser without user interaction.
 func PromptDownload() {
 	title := "Chrome not found"
 	text := "No Chrome/Chromium installation was found. Would you like to download and install it now?"
 
 	// Ask user for confirmation
-	if !messageBox(title, text) {
+	if ok, _ := dialog.Confirm(title, text); !ok {
 		return
 	}
 
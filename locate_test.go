@@ -1,7 +1,11 @@
 package lorca
 
 import (
+	"errors"
+	"io/ioutil"
 	"os/exec"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -15,3 +19,99 @@ func TestLocate(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestLocateBrowsers(t *testing.T) {
+	for _, b := range LocateBrowsers() {
+		t.Log(b.Path, b.Product, b.Channel, b.Version)
+		if b.Path == "" || b.Product == "" || b.Channel == "" {
+			t.Error(b)
+		}
+	}
+}
+
+func TestClassifyBrowser(t *testing.T) {
+	for path, want := range map[string][2]string{
+		"/usr/bin/google-chrome-stable":                     {"Chrome", "stable"},
+		"/usr/bin/google-chrome-unstable":                   {"Chrome", "dev"},
+		"/snap/bin/chromium":                                {"Chromium", "stable"},
+		"/var/lib/flatpak/exports/bin/com.google.ChromeDev": {"Chrome", "dev"},
+		"/usr/bin/microsoft-edge-beta":                      {"Edge", "beta"},
+		"/usr/bin/brave-browser":                            {"Brave", "stable"},
+		"/Applications/Google Chrome Canary.app/Contents/MacOS/Google Chrome Canary": {"Chrome", "canary"},
+		"C:/Users/x/AppData/Local/Google/Chrome SxS/Application/chrome.exe":          {"Chrome", "canary"},
+		"C:/Program Files/Chromium/Application/chrome.exe":                           {"Chromium", "stable"},
+	} {
+		if product, channel := classifyBrowser(path); product != want[0] || channel != want[1] {
+			t.Error(path, product, channel)
+		}
+	}
+}
+
+func TestSortBrowsers(t *testing.T) {
+	browsers := []Browser{
+		{Path: "/usr/bin/microsoft-edge-beta", Product: "Edge", Channel: "beta"},
+		{Path: "/usr/bin/brave-browser", Product: "Brave", Channel: "stable"},
+		{Path: "/usr/bin/google-chrome-beta", Product: "Chrome", Channel: "beta"},
+		{Path: "/opt/custom/chrome", Product: "Chrome", Channel: "canary"},
+		{Path: "/usr/bin/google-chrome-stable", Product: "Chrome", Channel: "stable"},
+	}
+	sortBrowsers(browsers, "/opt/custom/chrome")
+	paths := []string{}
+	for _, b := range browsers {
+		paths = append(paths, b.Path)
+	}
+	want := []string{
+		"/opt/custom/chrome",
+		"/usr/bin/google-chrome-stable",
+		"/usr/bin/brave-browser",
+		"/usr/bin/google-chrome-beta",
+		"/usr/bin/microsoft-edge-beta",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Error(paths)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		A, B string
+		Cmp  int
+	}{
+		{"120.0.6099.109", "120.0.6099.109", 0},
+		{"120.0.6099.109", "99.0.4844.51", 1},
+		{"99.0.4844.51", "120.0.6099.109", -1},
+		{"120.0.6099.109", "", 1},
+	} {
+		if cmp := compareVersions(test.A, test.B); cmp != test.Cmp {
+			t.Error(test, cmp)
+		}
+	}
+	if major := (Browser{Version: "120.0.6099.109"}).Major(); major != 120 {
+		t.Error(major)
+	}
+}
+
+func TestBrowserNotFound(t *testing.T) {
+	defer func(f func() string) { ChromeExecutable = f }(ChromeExecutable)
+	ChromeExecutable = func() string { return "" }
+	_, err := NewWithOptions(Options{Headless: true})
+	if !errors.Is(err, ErrBrowserNotFound) {
+		t.Fatal(err)
+	}
+	e := &BrowserNotFoundError{}
+	if !errors.As(err, &e) || len(e.Searched) == 0 {
+		t.Fatal(err)
+	}
+}
+
+func TestLocateChromeEnv(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "chrome")
+	if err := ioutil.WriteFile(exe, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LORCACHROME", exe)
+	// LocateChrome agrees with the browser order of LocateBrowsers
+	if path, browsers := LocateChrome(), LocateBrowsers(); path != exe || browsers[0].Path != exe {
+		t.Fatal(path, browsers)
+	}
+}
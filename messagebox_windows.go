@@ -1,19 +0,0 @@
-//+build windows
-
-package lorca
-
-import (
-	"syscall"
-	"unsafe"
-)
-
-func messageBox(title, text string) bool {
-	user32 := syscall.NewLazyDLL("user32.dll")
-	messageBoxW := user32.NewProc("MessageBoxW")
-	mbYesNo := 0x00000004
-	mbIconQuestion := 0x00000020
-	idYes := 6
-	ret, _, _ := messageBoxW.Call(0, uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(text))),
-		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(title))), uintptr(uint(mbYesNo|mbIconQuestion)))
-	return int(ret) == idYes
-}
@@ -0,0 +1,143 @@
+package lorca
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// Options configure the browser started by NewWithOptions. The zero value is
+// a blank window of the default size in a temporary profile.
+type Options struct {
+	// URL is the initial page, a blank page is displayed if it's empty.
+	URL string
+	// Executable is the browser binary, ChromeExecutable() is used if it's
+	// empty and Policy is not set.
+	Executable string
+	// Policy selects one of the installed browsers if Executable is empty,
+	// see SelectBrowser.
+	Policy BrowserPolicy
+	// ProfileDir is the user profile directory. If it's empty a temporary
+	// directory is created and removed on Close.
+	ProfileDir string
+	// Bounds are the initial window position, size and state. Zero position or
+	// size leave the choice to the browser.
+	Bounds Bounds
+	// Kiosk opens the window in kiosk mode, without any way to leave it.
+	Kiosk bool
+	// Fullscreen opens the window in fullscreen mode.
+	Fullscreen bool
+	// Incognito opens the page in an incognito profile, nothing is persisted.
+	Incognito bool
+	// Headless runs the browser without a window, which is useful for tests.
+	Headless bool
+	// Proxy is the proxy server, e.g. "socks5://localhost:1080".
+	Proxy string
+	// Lang is the UI language and the default Accept-Language, e.g. "de-DE".
+	Lang string
+	// DeviceScaleFactor overrides the display scale factor if it's non-zero.
+	DeviceScaleFactor float64
+	// Class is the window class name, only used on Linux.
+	Class string
+	// Env are extra environment variables of the browser process, in the
+	// "key=value" form, added to the environment of the current process.
+	Env []string
+	// StartTimeout is how long the browser may take to start, 30 seconds by
+	// default. If the browser fails to start a *StartError is returned.
+	StartTimeout time.Duration
+	// CloseTimeout is how long Close waits for the browser to exit gracefully
+	// and save the profile before killing it, 5 seconds by default.
+	CloseTimeout time.Duration
+	// Supervisor restarts the browser after crashes if it's not nil.
+	Supervisor *Supervisor
+	// Discovery is how the DevTools endpoint of the browser is found, by
+	// default both stderr and the DevToolsActivePort file are watched.
+	Discovery Discovery
+	// Stderr receives everything the browser prints to stderr, which is
+	// discarded by default.
+	Stderr io.Writer
+	// Logger receives Lorca logs, JS console messages and browser stderr at
+	// the debug level. slog.Default() is used if it's nil, except for JS
+	// console messages that are printed by the standard log package.
+	Logger *slog.Logger
+	// Trace enables tracing of the DevTools protocol messages if it's not nil.
+	Trace *Trace
+	// StreamRelay lets handlers passed to UI.Handle stream the responses they
+	// flush (http.Flusher), e.g. server-sent events or long-polling, through a
+	// relay listening on 127.0.0.1. The Fetch domain can only deliver complete
+	// responses, so without the relay no sockets are opened, but responses
+	// reach the page only once the handler returns.
+	StreamRelay bool
+	// Record receives the complete DevTools protocol session as JSON lines, to
+	// be played back later by Replay.
+	Record io.Writer
+	// WorkingDir is the working directory of the browser process.
+	WorkingDir string
+	// ExtraArgs are additional command line flags passed to the browser.
+	ExtraArgs []string
+	// DisableDefaultArgs omits the flags Lorca passes by default, see
+	// DefaultArgs. Flags required to control the browser are always passed.
+	DisableDefaultArgs bool
+}
+
+// DefaultArgs returns the command line flags Lorca passes to the browser
+// unless Options.DisableDefaultArgs is set.
+func DefaultArgs() []string {
+	return append([]string{}, defaultChromeArgs...)
+}
+
+// args returns the browser command line flags for the options and the given
+// profile directory.
+func (o Options) args(dir string) []string {
+	args := []string{}
+	if !o.DisableDefaultArgs {
+		args = append(args, defaultChromeArgs...)
+	}
+	url := o.URL
+	if url == "" {
+		url = "data:text/html,<html></html>"
+	}
+	args = append(args, fmt.Sprintf("--app=%s", url))
+	args = append(args, fmt.Sprintf("--user-data-dir=%s", dir))
+	if b := o.Bounds; b.Width > 0 && b.Height > 0 {
+		args = append(args, fmt.Sprintf("--window-size=%d,%d", b.Width, b.Height))
+	}
+	if b := o.Bounds; b.Left != 0 || b.Top != 0 {
+		args = append(args, fmt.Sprintf("--window-position=%d,%d", b.Left, b.Top))
+	}
+	switch o.Bounds.WindowState {
+	case WindowStateMaximized:
+		args = append(args, "--start-maximized")
+	case WindowStateFullscreen:
+		o.Fullscreen = true
+	}
+	if o.Kiosk {
+		args = append(args, "--kiosk")
+	}
+	if o.Fullscreen {
+		args = append(args, "--start-fullscreen")
+	}
+	if o.Incognito {
+		args = append(args, "--incognito")
+	}
+	if o.Headless {
+		args = append(args, "--headless")
+	}
+	if o.Proxy != "" {
+		args = append(args, fmt.Sprintf("--proxy-server=%s", o.Proxy))
+	}
+	if o.Lang != "" {
+		args = append(args, fmt.Sprintf("--lang=%s", o.Lang))
+	}
+	if o.DeviceScaleFactor > 0 {
+		args = append(args, "--force-device-scale-factor="+strconv.FormatFloat(o.DeviceScaleFactor, 'f', -1, 64))
+	}
+	if o.Class != "" && runtime.GOOS == "linux" {
+		args = append(args, fmt.Sprintf("--class=%s", o.Class))
+	}
+	args = append(args, o.ExtraArgs...)
+	return append(args, "--remote-allow-origins=*", "--remote-debugging-port=0")
+}
@@ -0,0 +1,61 @@
+package lorca
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestOptionsArgs(t *testing.T) {
+	// The window class is only set on Linux
+	class := []string{}
+	if runtime.GOOS == "linux" {
+		class = []string{"--class=Lorca"}
+	}
+	for _, test := range []struct {
+		Options Options
+		Args    []string
+	}{
+		{
+			Options: Options{DisableDefaultArgs: true},
+			Args:    []string{"--app=data:text/html,<html></html>", "--user-data-dir=/tmp/x", "--remote-allow-origins=*", "--remote-debugging-port=0"},
+		},
+		{
+			Options: Options{
+				URL:                "https://example.com/",
+				Bounds:             Bounds{Left: 10, Top: 20, Width: 640, Height: 480, WindowState: WindowStateMaximized},
+				Kiosk:              true,
+				Incognito:          true,
+				Headless:           true,
+				Proxy:              "socks5://localhost:1080",
+				Lang:               "de-DE",
+				DeviceScaleFactor:  1.5,
+				Class:              "Lorca",
+				ExtraArgs:          []string{"--mute-audio"},
+				DisableDefaultArgs: true,
+			},
+			Args: append(append([]string{
+				"--app=https://example.com/",
+				"--user-data-dir=/tmp/x",
+				"--window-size=640,480",
+				"--window-position=10,20",
+				"--start-maximized",
+				"--kiosk",
+				"--incognito",
+				"--headless",
+				"--proxy-server=socks5://localhost:1080",
+				"--lang=de-DE",
+				"--force-device-scale-factor=1.5",
+			}, class...), "--mute-audio", "--remote-allow-origins=*", "--remote-debugging-port=0"),
+		},
+	} {
+		if args := test.Options.args("/tmp/x"); !reflect.DeepEqual(args, test.Args) {
+			t.Error(args, test.Args)
+		}
+	}
+
+	args := Options{}.args("/tmp/x")
+	if n := len(defaultChromeArgs); len(args) != n+4 || !reflect.DeepEqual(args[:n], defaultChromeArgs) {
+		t.Error(args)
+	}
+}
@@ -0,0 +1,53 @@
+package lorca
+
+import (
+	"os/exec"
+	"runtime"
+	"sync"
+	"syscall"
+)
+
+// startProcess starts the browser in its own process group, so that renderer
+// and helper processes can be killed together. The browser is also killed if
+// the parent process dies, even if it crashes.
+func startProcess(cmd *exec.Cmd) (kill func() error, err error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.SysProcAttr.Pdeathsig = syscall.SIGKILL
+	if err := startLocked(cmd); err != nil {
+		return nil, err
+	}
+	return func() error { return killProcessGroup(cmd) }, nil
+}
+
+// Pdeathsig is sent when the OS thread that started the process exits, not
+// the whole parent process. Go runtime may terminate any thread, so browsers
+// are started from a goroutine that is locked to its thread and never exits.
+var (
+	starterOnce sync.Once
+	starts      chan processStart
+)
+
+type processStart struct {
+	cmd *exec.Cmd
+	err chan error
+}
+
+// startLocked starts the command from the thread that lives as long as the
+// current process.
+func startLocked(cmd *exec.Cmd) error {
+	starterOnce.Do(func() {
+		starts = make(chan processStart)
+		go func() {
+			runtime.LockOSThread()
+			for s := range starts {
+				s.err <- s.cmd.Start()
+			}
+		}()
+	})
+	s := processStart{cmd: cmd, err: make(chan error, 1)}
+	starts <- s
+	return <-s.err
+}
@@ -0,0 +1,82 @@
+package lorca
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKillProcessGroup(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 30 & echo $!; wait")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kill, err := startProcess(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kill(); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+	// Killed process may remain a zombie if nobody reaps it
+	running := func() bool {
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", child))
+		return err == nil && !strings.Contains(string(stat), ") Z ")
+	}
+	for i := 0; running(); i++ {
+		if i > 100 {
+			t.Fatal("child process is still running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartProcessThreadExit(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	for {
+		started := make(chan error)
+		go func() {
+			// The thread of a goroutine that exits while locked is terminated,
+			// except for the main thread
+			runtime.LockOSThread()
+			if syscall.Gettid() == syscall.Getpid() {
+				started <- errMainThread
+				return
+			}
+			_, err := startProcess(cmd)
+			started <- err
+		}()
+		if err := <-started; err == nil {
+			break
+		} else if err != errMainThread {
+			t.Fatal(err)
+		}
+	}
+	defer cmd.Wait()
+	defer killProcessGroup(cmd)
+	time.Sleep(200 * time.Millisecond)
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", cmd.Process.Pid))
+	if err != nil || strings.Contains(string(stat), ") Z ") {
+		t.Fatal("process is killed when the starting thread exits", string(stat), err)
+	}
+}
+
+var errMainThread = errors.New("main thread")
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package lorca
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
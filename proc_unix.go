@@ -0,0 +1,22 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package lorca
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startProcess starts the browser in its own process group, so that renderer
+// and helper processes can be killed together.
+func startProcess(cmd *exec.Cmd) (kill func() error, err error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return func() error { return killProcessGroup(cmd) }, nil
+}
@@ -0,0 +1,113 @@
+//go:build windows
+// +build windows
+
+package lorca
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                 = syscall.NewLazyDLL("kernel32.dll")
+	createJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	setInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	assignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	terminateJobObject       = kernel32.NewProc("TerminateJobObject")
+	ntResumeProcess          = syscall.NewLazyDLL("ntdll.dll").NewProc("NtResumeProcess")
+)
+
+const (
+	jobObjectExtendedLimitInformationClass = 9
+	jobObjectLimitKillOnJobClose           = 0x2000
+	processSetQuota                        = 0x0100
+	processTerminate                       = 0x0001
+	processSuspendResume                   = 0x0800
+	createSuspended                        = 0x00000004
+)
+
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type jobObjectExtendedLimitInformation struct {
+	BasicLimitInformation jobObjectBasicLimitInformation
+	IoInfo                [6]uint64
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// startProcess starts the browser in a job object, so that renderer and
+// helper processes can be killed together. The browser is started suspended
+// and resumed once it's in the job, so that no helper process escapes it. The
+// job is closed by the OS when the parent process dies, which kills the
+// browser as well. If the job can't be created only the browser process
+// itself is killed.
+func startProcess(cmd *exec.Cmd) (kill func() error, err error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= createSuspended
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	process, err := syscall.OpenProcess(processSetQuota|processTerminate|processSuspendResume, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+	defer syscall.CloseHandle(process)
+	job, jobErr := newJob(process)
+	if r, _, err := ntResumeProcess.Call(uintptr(process)); r != 0 {
+		if jobErr == nil {
+			syscall.CloseHandle(job)
+		}
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+	if jobErr != nil {
+		return cmd.Process.Kill, nil
+	}
+	once := sync.Once{}
+	return func() error {
+		once.Do(func() {
+			terminateJobObject.Call(uintptr(job), 1)
+			syscall.CloseHandle(job)
+		})
+		return cmd.Process.Kill()
+	}, nil
+}
+
+func newJob(process syscall.Handle) (syscall.Handle, error) {
+	r, _, err := createJobObjectW.Call(0, 0)
+	if r == 0 {
+		return 0, err
+	}
+	job := syscall.Handle(r)
+	info := jobObjectExtendedLimitInformation{}
+	info.BasicLimitInformation.LimitFlags = jobObjectLimitKillOnJobClose
+	if r, _, err := setInformationJobObject.Call(uintptr(job), jobObjectExtendedLimitInformationClass,
+		uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info)); r == 0 {
+		syscall.CloseHandle(job)
+		return 0, err
+	}
+	if r, _, err := assignProcessToJobObject.Call(uintptr(job), uintptr(process)); r == 0 {
+		syscall.CloseHandle(job)
+		return 0, err
+	}
+	return job, nil
+}
@@ -0,0 +1,354 @@
+package lorca
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+)
+
+// ReplayOptions configures how a recorded session is played back.
+type ReplayOptions struct {
+	// IgnoreParams are the names of command params, at any depth, that are
+	// not compared when live commands are matched against the recorded ones,
+	// e.g. timestamps or temporary paths. Command IDs are never compared.
+	IgnoreParams []string
+	// Logger receives Lorca logs and JS console messages. slog.Default() is
+	// used if it's nil, except for JS console messages that are printed by
+	// the standard log package.
+	Logger *slog.Logger
+	// Trace enables tracing of the replayed protocol messages if it's not nil.
+	Trace *Trace
+}
+
+// Replay returns a UI that plays back a DevTools protocol session recorded
+// with Options.Record instead of talking to a browser, so that tests don't
+// depend on a browser installed or on its timing.
+//
+// Every command is answered with the responses and events recorded after the
+// first unused recorded command with the same method and params. Commands may
+// come in a different order than recorded. Commands that have not been
+// recorded fail with an error. Close ends the replay.
+func Replay(r io.Reader, o ReplayOptions) (UI, error) {
+	p, headless, err := newReplayTransport(r, o.IgnoreParams)
+	if err != nil {
+		return nil, err
+	}
+	c := newChromeState(Options{Logger: o.Logger, Trace: o.Trace})
+	p.log = c.log
+	c.headless = headless
+	c.exited, c.killProcess = p.done, p.Close
+	if err := c.connect(p); err != nil {
+		return nil, err
+	}
+	c.init()
+	return &ui{chrome: c, done: c.done}, nil
+}
+
+// cdpMessage is a command, a response or an event, with the ID that might be
+// zero and the params that might be an encoded message.
+type cdpMessage struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type targetMessageParams struct {
+	SessionID string `json:"sessionId"`
+	Message   string `json:"message"`
+}
+
+// replayCommand is a recorded command with the messages received after it,
+// until the next command.
+type replayCommand struct {
+	method  string
+	inner   bool
+	params  interface{}
+	outerID *int
+	innerID *int
+	frames  [][]byte
+	used    bool
+}
+
+// replayTransport answers commands with the recorded messages.
+type replayTransport struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	commands []*replayCommand
+	ignore   map[string]bool
+	queue    [][]byte
+	closed   bool
+	done     chan struct{}
+	log      *slog.Logger
+}
+
+func newReplayTransport(r io.Reader, ignore []string) (*replayTransport, bool, error) {
+	p := &replayTransport{ignore: map[string]bool{}, done: make(chan struct{}), log: slog.Default()}
+	p.cond = sync.NewCond(&p.mu)
+	for _, name := range ignore {
+		p.ignore[name] = true
+	}
+	started, headless := false, false
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		e := recordEntry{}
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, false, fmt.Errorf("replay: entry %d: %w", line, err)
+		}
+		switch e.Dir {
+		case recordStart:
+			if !started {
+				started, headless = true, e.Headless
+			}
+		case recordSend:
+			cmd, err := p.command(e.Message)
+			if err != nil {
+				return nil, false, fmt.Errorf("replay: entry %d: %w", line, err)
+			}
+			p.commands = append(p.commands, cmd)
+		case recordReceive:
+			if err := p.received(e.Message); err != nil {
+				return nil, false, fmt.Errorf("replay: entry %d: %w", line, err)
+			}
+		default:
+			return nil, false, fmt.Errorf("replay: entry %d: unknown direction %q", line, e.Dir)
+		}
+	}
+	if !started {
+		return nil, false, errors.New("replay: no recorded session")
+	}
+	return p, headless, nil
+}
+
+// command parses a command, unwrapping the ones sent to the page session.
+func (p *replayTransport) command(b []byte) (*replayCommand, error) {
+	m := cdpMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	cmd := &replayCommand{method: m.Method, outerID: m.ID}
+	if m.Method == "Target.sendMessageToTarget" {
+		params := targetMessageParams{}
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			return nil, err
+		}
+		inner := cdpMessage{}
+		if err := json.Unmarshal([]byte(params.Message), &inner); err != nil {
+			return nil, err
+		}
+		cmd.method, cmd.inner, cmd.innerID, m.Params = inner.Method, true, inner.ID, inner.Params
+	}
+	params, err := p.normalize(m.Params)
+	if err != nil {
+		return nil, err
+	}
+	cmd.params = params
+	return cmd, nil
+}
+
+// received attaches a received message to the command it responds to.
+// Events are attached to the most recent command.
+func (p *replayTransport) received(b []byte) error {
+	m := cdpMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	var cmd *replayCommand
+	if m.ID != nil {
+		cmd = p.lastCommand(func(cmd *replayCommand) bool { return cmd.outerID != nil && *cmd.outerID == *m.ID })
+	} else if m.Method == "Target.receivedMessageFromTarget" {
+		params := targetMessageParams{}
+		json.Unmarshal(m.Params, &params)
+		inner := cdpMessage{}
+		json.Unmarshal([]byte(params.Message), &inner)
+		if inner.ID != nil {
+			cmd = p.lastCommand(func(cmd *replayCommand) bool {
+				return cmd.inner && cmd.innerID != nil && *cmd.innerID == *inner.ID
+			})
+		}
+	}
+	if cmd == nil && len(p.commands) > 0 {
+		cmd = p.commands[len(p.commands)-1]
+	}
+	if cmd != nil {
+		cmd.frames = append(cmd.frames, b)
+	}
+	return nil
+}
+
+func (p *replayTransport) lastCommand(f func(cmd *replayCommand) bool) *replayCommand {
+	for i := len(p.commands) - 1; i >= 0; i-- {
+		if f(p.commands[i]) {
+			return p.commands[i]
+		}
+	}
+	return nil
+}
+
+// normalize decodes params for comparison, without the ignored ones.
+func (p *replayTransport) normalize(b json.RawMessage) (interface{}, error) {
+	var v interface{}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+	}
+	var strip func(v interface{}) interface{}
+	strip = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, x := range v {
+				if p.ignore[k] {
+					delete(v, k)
+				} else {
+					v[k] = strip(x)
+				}
+			}
+			if len(v) == 0 {
+				return nil
+			}
+		case []interface{}:
+			for i, x := range v {
+				v[i] = strip(x)
+			}
+		}
+		return v
+	}
+	return strip(v), nil
+}
+
+func (p *replayTransport) Send(b []byte) error {
+	live, err := p.command(b)
+	if err != nil {
+		return err
+	}
+	session := ""
+	if live.inner {
+		params := targetMessageParams{}
+		json.Unmarshal(b, &struct {
+			Params *targetMessageParams `json:"params"`
+		}{&params})
+		session = params.SessionID
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return io.ErrClosedPipe
+	}
+	var recorded *replayCommand
+	for _, cmd := range p.commands {
+		if !cmd.used && cmd.method == live.method && cmd.inner == live.inner && reflect.DeepEqual(cmd.params, live.params) {
+			recorded = cmd
+			break
+		}
+	}
+	if recorded != nil {
+		recorded.used = true
+		for _, frame := range recorded.frames {
+			p.queue = append(p.queue, replayFrame(frame, live.outerID, live.innerID))
+		}
+	} else {
+		p.log.Warn("replay: command not recorded", "method", live.method)
+		p.queue = append(p.queue, replayError(live, session)...)
+	}
+	p.cond.Broadcast()
+	if live.method == "Browser.close" && !live.inner {
+		p.closeLocked()
+	}
+	return nil
+}
+
+// Receive returns the queued messages, then io.EOF once the replay is closed.
+func (p *replayTransport) Receive() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.queue) == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if len(p.queue) == 0 {
+		return nil, io.EOF
+	}
+	b := p.queue[0]
+	p.queue = p.queue[1:]
+	return b, nil
+}
+
+func (p *replayTransport) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeLocked()
+	return nil
+}
+
+func (p *replayTransport) closeLocked() {
+	if !p.closed {
+		p.closed = true
+		close(p.done)
+		p.cond.Broadcast()
+	}
+}
+
+// replayFrame replaces the recorded IDs in the response with the IDs of the
+// live command.
+func replayFrame(frame []byte, outerID, innerID *int) []byte {
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(frame, &m); err != nil {
+		return frame
+	}
+	if _, ok := m["id"]; ok && outerID != nil {
+		m["id"], _ = json.Marshal(*outerID)
+	} else if method := ""; json.Unmarshal(m["method"], &method) == nil &&
+		method == "Target.receivedMessageFromTarget" && innerID != nil {
+		params := map[string]json.RawMessage{}
+		message := ""
+		json.Unmarshal(m["params"], &params)
+		json.Unmarshal(params["message"], &message)
+		inner := map[string]json.RawMessage{}
+		if err := json.Unmarshal([]byte(message), &inner); err != nil {
+			return frame
+		}
+		if _, ok := inner["id"]; !ok {
+			return frame
+		}
+		inner["id"], _ = json.Marshal(*innerID)
+		b, _ := json.Marshal(inner)
+		params["message"], _ = json.Marshal(string(b))
+		m["params"], _ = json.Marshal(params)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return frame
+	}
+	return b
+}
+
+// replayError returns the error response to a command that has not been
+// recorded.
+func replayError(cmd *replayCommand, session string) [][]byte {
+	e := h{"code": -32000, "message": "replay: command not recorded: " + cmd.method}
+	id := 0
+	if cmd.outerID != nil {
+		id = *cmd.outerID
+	}
+	if !cmd.inner {
+		b, _ := json.Marshal(h{"id": id, "error": e})
+		return [][]byte{b}
+	}
+	innerID := 0
+	if cmd.innerID != nil {
+		innerID = *cmd.innerID
+	}
+	message, _ := json.Marshal(h{"id": innerID, "error": e})
+	outer, _ := json.Marshal(h{"id": id, "result": h{}})
+	event, _ := json.Marshal(h{
+		"method": "Target.receivedMessageFromTarget",
+		"params": h{"sessionId": session, "message": string(message)},
+	})
+	return [][]byte{outer, event}
+}
@@ -0,0 +1,181 @@
+package lorca
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+// fakeDevTools answers every command with an empty result, except for
+// Runtime.evaluate that returns the length of the expression, or NaN for
+// "NaN". Page commands fail if fail returns true for their method.
+func fakeDevTools(ws *websocket.Conn, fail func(method string) bool) {
+	for {
+		m := struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				SessionID string `json:"sessionId"`
+				Message   string `json:"message"`
+			} `json:"params"`
+		}{}
+		if err := websocket.JSON.Receive(ws, &m); err != nil {
+			return
+		}
+		switch m.Method {
+		case "Target.setDiscoverTargets":
+			websocket.JSON.Send(ws, h{"method": "Target.targetCreated", "params": h{
+				"targetInfo": h{"type": "page", "targetId": "T"},
+			}})
+			websocket.JSON.Send(ws, h{"id": m.ID, "result": h{}})
+		case "Target.attachToTarget":
+			websocket.JSON.Send(ws, h{"id": m.ID, "result": h{"sessionId": "S"}})
+		case "Target.sendMessageToTarget":
+			inner := struct {
+				ID     int    `json:"id"`
+				Method string `json:"method"`
+				Params struct {
+					Expression string `json:"expression"`
+				} `json:"params"`
+			}{}
+			json.Unmarshal([]byte(m.Params.Message), &inner)
+			res := h{}
+			if inner.Method == "Runtime.evaluate" {
+				n := len(inner.Params.Expression)
+				res = h{"result": h{"type": "number", "value": n, "deepSerializedValue": h{"type": "number", "value": n}}}
+				if inner.Params.Expression == "NaN" {
+					res = h{"result": h{"type": "number", "unserializableValue": "NaN", "deepSerializedValue": h{"type": "number", "value": "NaN"}}}
+				}
+			}
+			b, _ := json.Marshal(h{"id": inner.ID, "result": res})
+			if fail != nil && fail(inner.Method) {
+				b, _ = json.Marshal(h{"id": inner.ID, "error": h{"code": -32000, "message": inner.Method + " failed"}})
+			}
+			websocket.JSON.Send(ws, h{"id": m.ID, "result": h{}})
+			websocket.JSON.Send(ws, h{"method": "Target.receivedMessageFromTarget", "params": h{
+				"sessionId": m.Params.SessionID, "message": string(b),
+			}})
+		default:
+			websocket.JSON.Send(ws, h{"id": m.ID, "result": h{}})
+		}
+	}
+}
+
+func record(t *testing.T, fail func(method string) bool, f func(c *chrome)) []byte {
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) { fakeDevTools(ws, fail) }))
+	defer srv.Close()
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", "http://127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	c := newChromeState(Options{Record: buf})
+	c.headless = true
+	exited, once := make(chan struct{}), sync.Once{}
+	c.exited, c.killProcess = exited, func() error { once.Do(func() { close(exited) }); return nil }
+	if err := c.connect(newRecorder(&wsTransport{ws}, c.record, c.headless)); err != nil {
+		t.Fatal(err)
+	}
+	f(c)
+	c.kill()
+	return buf.Bytes()
+}
+
+func TestReplay(t *testing.T) {
+	rec := record(t, nil, func(c *chrome) {
+		if v, err := c.eval("1+2"); err != nil || string(v) != "3" {
+			t.Fatal(string(v), err)
+		}
+		if v, err := c.eval("Date.now()"); err != nil || string(v) != "10" {
+			t.Fatal(string(v), err)
+		}
+	})
+
+	ui, err := Replay(bytes.NewReader(rec), ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Command IDs are shifted by a command that has not been recorded
+	if err := ui.Load("about:blank"); err == nil || !strings.Contains(err.Error(), "Page.navigate") {
+		t.Fatal(err)
+	}
+	// Commands are matched in any order
+	if v := ui.Eval("Date.now()"); v.Err() != nil || v.Int() != 10 {
+		t.Fatal(v.Int(), v.Err())
+	}
+	if v := ui.Eval("1+2"); v.Err() != nil || v.Int() != 3 {
+		t.Fatal(v.Int(), v.Err())
+	}
+	// Every recorded command is answered only once
+	if v := ui.Eval("1+2"); v.Err() == nil {
+		t.Fatal(v.Int())
+	}
+	if err := ui.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-ui.Done()
+	if e := (*ExitError)(nil); !errors.As(ui.Err(), &e) || e.Reason != ExitClosed {
+		t.Fatal(ui.Err())
+	}
+
+	// Ignored params are not compared
+	ui, err = Replay(bytes.NewReader(rec), ReplayOptions{IgnoreParams: []string{"expression"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+	if v := ui.Eval("new Date().getTime()"); v.Err() != nil || v.Int() != 3 {
+		t.Fatal(v.Int(), v.Err())
+	}
+}
+
+func TestReplayEvalDeep(t *testing.T) {
+	rec := record(t, nil, func(c *chrome) { c.eval("NaN") })
+	ui, err := Replay(bytes.NewReader(rec), ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+	if f := ui.Eval("NaN").Float(); !math.IsNaN(float64(f)) {
+		t.Fatal(f)
+	}
+}
+
+func TestReplayInvalid(t *testing.T) {
+	for _, rec := range []string{
+		"",
+		"{",
+		`{"dir":"unknown"}`,
+		`{"dir":"send","message":{"id":1,"method":"Page.enable"}}`,
+	} {
+		if _, err := Replay(strings.NewReader(rec), ReplayOptions{}); err == nil {
+			t.Error(rec)
+		}
+	}
+}
+
+func TestReplayFrame(t *testing.T) {
+	outer, inner := 7, 8
+	for _, test := range []struct {
+		Frame string
+		Want  string
+	}{
+		{`{"id":0,"result":{}}`, `{"id":7,"result":{}}`},
+		{`{"method":"Page.loadEventFired","params":{}}`, `{"method":"Page.loadEventFired","params":{}}`},
+		{
+			`{"method":"Target.receivedMessageFromTarget","params":{"message":"{\"id\":3,\"result\":{}}","sessionId":"S"}}`,
+			`{"method":"Target.receivedMessageFromTarget","params":{"message":"{\"id\":8,\"result\":{}}","sessionId":"S"}}`,
+		},
+	} {
+		if got := string(replayFrame([]byte(test.Frame), &outer, &inner)); got != test.Want {
+			t.Error(got, test.Want)
+		}
+	}
+}
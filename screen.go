@@ -0,0 +1,86 @@
+package lorca
+
+import (
+	"fmt"
+)
+
+// Screen describes a display connected to the computer. Bounds and work area
+// are in the global screen coordinates used by window bounds.
+type Screen struct {
+	Label       string  `json:"label"`
+	Bounds      Rect    `json:"bounds"`
+	WorkArea    Rect    `json:"workArea"`
+	ScaleFactor float64 `json:"scaleFactor"`
+	Primary     bool    `json:"primary"`
+}
+
+// Window Management API lists all the screens, but it's only available in
+// secure contexts and in recent browsers. Otherwise only the screen of the
+// current window is reported.
+const screensScript = `(async () => {
+	const rect = (left, top, width, height) => ({left, top, width, height});
+	const info = (s, primary) => ({
+		label: s.label || '',
+		bounds: rect(s.left ?? 0, s.top ?? 0, s.width, s.height),
+		workArea: rect(s.availLeft ?? 0, s.availTop ?? 0, s.availWidth, s.availHeight),
+		scaleFactor: s.devicePixelRatio ?? window.devicePixelRatio,
+		primary: s.isPrimary ?? primary,
+	});
+	if (window.getScreenDetails) {
+		try {
+			const details = await window.getScreenDetails();
+			return details.screens.map(s => info(s, false));
+		} catch (e) {}
+	}
+	return [info(window.screen, true)];
+})()`
+
+func (c *chrome) screens() ([]Screen, error) {
+	// The permission used to be called windowPlacement in older browsers. If
+	// neither is known, screen details are rejected and the fallback is used.
+	if _, err := c.send("Browser.grantPermissions", h{"permissions": []string{"windowManagement"}}); err != nil {
+		c.send("Browser.grantPermissions", h{"permissions": []string{"windowPlacement"}})
+	}
+	screens := []Screen{}
+	if err := c.evaluate(h{"expression": screensScript, "awaitPromise": true, "userGesture": true}).To(&screens); err != nil {
+		return nil, err
+	}
+	if len(screens) == 0 {
+		return nil, fmt.Errorf("no screens found")
+	}
+	return screens, nil
+}
+
+// center moves the window to the center of the screen work area, keeping its
+// size and state. A negative screen index means the screen where most of the
+// window currently is.
+func (c *chrome) center(index int) error {
+	screens, err := c.screens()
+	if err != nil {
+		return err
+	}
+	if index >= len(screens) {
+		return fmt.Errorf("screen %d not found, %d screens available", index, len(screens))
+	}
+	b, err := c.bounds()
+	if err != nil {
+		return err
+	}
+	areas := make([]Rect, len(screens))
+	for i, s := range screens {
+		areas[i] = s.WorkArea
+	}
+	if index < 0 {
+		index = bestArea(b, areas)
+	}
+	return c.setBounds(centerBounds(b, areas[index]))
+}
+
+// centerBounds places the bounds in the center of the area, shrinking them if
+// they don't fit.
+func centerBounds(b Bounds, area Rect) Bounds {
+	b.Width, b.Height = minInt(b.Width, area.Width), minInt(b.Height, area.Height)
+	b.Left = area.Left + (area.Width-b.Width)/2
+	b.Top = area.Top + (area.Height-b.Height)/2
+	return b
+}
@@ -0,0 +1,46 @@
+package lorca
+
+import "testing"
+
+func TestCenterBounds(t *testing.T) {
+	area := Rect{Left: 1920, Top: 0, Width: 1280, Height: 1000}
+	for _, test := range []struct {
+		Bounds   Bounds
+		Centered Bounds
+	}{
+		{Bounds{Left: 10, Top: 10, Width: 800, Height: 600}, Bounds{Left: 2160, Top: 200, Width: 800, Height: 600}},
+		{Bounds{Left: 10, Top: 10, Width: 2000, Height: 600}, Bounds{Left: 1920, Top: 200, Width: 1280, Height: 600}},
+	} {
+		if b := centerBounds(test.Bounds, area); b != test.Centered {
+			t.Error(test.Bounds, b, test.Centered)
+		}
+	}
+}
+
+func TestScreens(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	screens, err := ui.Screens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := 0
+	for _, s := range screens {
+		if s.Bounds.Width <= 0 || s.Bounds.Height <= 0 || s.WorkArea.Width <= 0 || s.ScaleFactor <= 0 {
+			t.Error(s)
+		}
+		if s.Primary {
+			primary++
+		}
+	}
+	if primary != 1 {
+		t.Error(screens)
+	}
+	if err := ui.MoveToScreen(len(screens)); err == nil {
+		t.Error("moving to non-existing screen should fail")
+	}
+}
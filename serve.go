@@ -0,0 +1,340 @@
+package lorca
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// relayTimeout is how long a streamed response waits for the browser to
+// connect to the relay.
+var relayTimeout = 30 * time.Second
+
+var errRelayTimeout = errors.New("browser did not connect to the stream relay")
+
+// handle serves requests for the given origin with an HTTP handler inside the
+// current process. Responses are buffered and delivered to the browser when
+// the handler returns, without any network sockets. If the stream relay is
+// enabled and the handler flushes the response with http.Flusher, e.g. to
+// send server-sent events, it's streamed instead: the request is
+// transparently redirected to a relay that listens on 127.0.0.1 and forwards
+// the response as it's written.
+func (c *chrome) handle(origin string, handler http.Handler) error {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("origin must be an absolute http(s) URL: %s", origin)
+	}
+	prefix := u.Scheme + "://" + u.Host + "/"
+	c.Lock()
+	c.served = append(c.served, prefix)
+	c.Unlock()
+	return c.route(prefix+"*", func(p *requestPaused) { c.serveHTTP(handler, p) })
+}
+
+func (c *chrome) serveHTTP(handler http.Handler, p *requestPaused) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, p.Request.Method, p.Request.URL, bytes.NewReader(p.body()))
+	if err != nil {
+		c.send("Fetch.failRequest", h{"requestId": p.ID, "errorReason": "Failed"})
+		return
+	}
+	for k, v := range p.Request.Headers {
+		req.Header.Set(k, v)
+	}
+	req.RequestURI = req.URL.RequestURI()
+	req.RemoteAddr = "127.0.0.1:0"
+	w := &responseWriter{header: http.Header{}}
+	if c.streamResponses && p.Request.Method != http.MethodHead {
+		w.stream = func(w *responseWriter) (*io.PipeWriter, error) { return c.streamResponse(p, w, cancel) }
+	}
+
+	if err := serveRecover(handler, w, req); err != nil {
+		c.log.Error("HTTP handler panicked", "url", p.Request.URL, "error", err)
+		if w.out != nil {
+			w.out.CloseWithError(err)
+		} else {
+			c.fulfill(p, http.StatusInternalServerError, http.Header{"Content-Length": {"0"}}, []byte{})
+		}
+		return
+	}
+	if w.out != nil {
+		w.out.Close()
+		return
+	}
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	body := w.body.Bytes()
+	if p.Request.Method == http.MethodHead {
+		body = nil
+	}
+	if w.header.Get("Content-Length") == "" && body != nil {
+		w.header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	c.fulfill(p, w.status, w.header, body)
+}
+
+// serveRecover calls the handler and returns an error if it panics.
+func serveRecover(handler http.Handler, w http.ResponseWriter, req *http.Request) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	handler.ServeHTTP(w, req)
+	return nil
+}
+
+// responseWriter buffers the response of an HTTP handler until it's flushed.
+// Like the one of net/http it detects the content type from the first
+// written bytes unless it's set explicitly.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// stream is called on the first flush and returns where the rest of the
+	// response is written to. The response stays buffered if it's nil or
+	// fails.
+	stream func(w *responseWriter) (*io.PipeWriter, error)
+	out    *io.PipeWriter
+}
+
+func (w *responseWriter) Header() http.Header { return w.header }
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		if _, ok := w.header["Content-Type"]; !ok && w.header.Get("Content-Encoding") == "" {
+			w.header.Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !bodyAllowed(w.status) {
+		return 0, errors.New("request method or response status code does not allow body")
+	}
+	if w.out != nil {
+		return w.out.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// Flush sends the status, headers and the body written so far, and streams
+// the rest of the body as it's written. Without a stream relay it only
+// commits the status code and the response stays buffered.
+func (w *responseWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.out != nil || w.stream == nil {
+		return
+	}
+	out, err := w.stream(w)
+	w.stream = nil
+	if err != nil {
+		return
+	}
+	w.out = out
+	if w.body.Len() > 0 {
+		out.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
+
+func bodyAllowed(status int) bool {
+	return (status < 100 || status > 199) && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// streamResponse redirects the paused request to the relay and returns the
+// writer for the response body. Cancel is called once the browser stops
+// reading the response.
+func (c *chrome) streamResponse(p *requestPaused, w *responseWriter, cancel func()) (*io.PipeWriter, error) {
+	r, err := c.streamRelay()
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	s := &relayStream{
+		header:    w.header.Clone(),
+		status:    w.status,
+		body:      pr,
+		cancel:    cancel,
+		connected: make(chan struct{}),
+	}
+	token, err := r.add(s)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.send("Fetch.continueRequest", h{"requestId": p.ID, "url": r.url + token}); err != nil {
+		r.take(token)
+		return nil, err
+	}
+	go func() {
+		t := time.NewTimer(relayTimeout)
+		defer t.Stop()
+		select {
+		case <-s.connected:
+		case <-t.C:
+			if r.take(token) != nil {
+				pr.CloseWithError(errRelayTimeout)
+				cancel()
+			}
+		}
+	}()
+	return pw, nil
+}
+
+// streamRelay returns the relay, starting it if needed. Its origin is
+// allowed by the network policy like the served ones.
+func (c *chrome) streamRelay() (*streamRelay, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.relay != nil {
+		return c.relay, nil
+	}
+	r, err := newStreamRelay()
+	if err != nil {
+		return nil, err
+	}
+	c.relay = r
+	c.served = append(c.served, r.url)
+	return r, nil
+}
+
+func (c *chrome) closeRelay() {
+	c.Lock()
+	r := c.relay
+	c.relay = nil
+	c.Unlock()
+	if r != nil {
+		r.close()
+	}
+}
+
+// streamRelay is a loopback HTTP server that streams responses to the
+// browser, as the Fetch domain can only fulfill requests with complete
+// bodies. Every stream is served once, at a random path.
+type streamRelay struct {
+	mu      sync.Mutex
+	srv     *http.Server
+	url     string
+	streams map[string]*relayStream
+}
+
+type relayStream struct {
+	header    http.Header
+	status    int
+	body      *io.PipeReader
+	cancel    func()
+	connected chan struct{}
+}
+
+func newStreamRelay() (*streamRelay, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &streamRelay{url: "http://" + ln.Addr().String() + "/", streams: map[string]*relayStream{}}
+	r.srv = &http.Server{Handler: r}
+	go r.srv.Serve(ln)
+	return r, nil
+}
+
+// add registers the stream and returns its path.
+func (r *streamRelay) add(s *relayStream) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	r.mu.Lock()
+	r.streams[token] = s
+	r.mu.Unlock()
+	return token, nil
+}
+
+// take unregisters the stream and returns it, or nil if it's not registered.
+func (r *streamRelay) take(token string) *relayStream {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.streams[token]
+	delete(r.streams, token)
+	return s
+}
+
+func (r *streamRelay) close() {
+	r.srv.Close()
+	r.mu.Lock()
+	streams := r.streams
+	r.streams = map[string]*relayStream{}
+	r.mu.Unlock()
+	for _, s := range streams {
+		s.body.CloseWithError(errRelayTimeout)
+		s.cancel()
+	}
+}
+
+func (r *streamRelay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s := r.take(strings.TrimPrefix(req.URL.Path, "/"))
+	if s == nil {
+		http.NotFound(w, req)
+		return
+	}
+	close(s.connected)
+	defer s.cancel()
+	// Unblock the handler if the browser goes away before it writes again
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-req.Context().Done():
+			s.body.CloseWithError(req.Context().Err())
+		case <-stop:
+		}
+	}()
+
+	for k, v := range s.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(s.status)
+	f, _ := w.(http.Flusher)
+	if f != nil {
+		f.Flush()
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := s.body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				s.body.CloseWithError(err)
+				return
+			}
+			if f != nil {
+				f.Flush()
+			}
+		}
+		if err != nil {
+			s.body.CloseWithError(err)
+			return
+		}
+	}
+}
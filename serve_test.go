@@ -0,0 +1,247 @@
+package lorca
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestResponseWriter(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html": {Data: []byte("<html><body>Hello</body></html>")},
+		"data":       {Data: []byte("0123456789")},
+	}
+	handler := http.FileServer(http.FS(files))
+
+	w := &responseWriter{header: http.Header{}}
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "https://app.lorca/data", nil))
+	if w.status != 200 || w.body.String() != "0123456789" || w.header.Get("Content-Type") == "" {
+		t.Fatal(w.status, w.body.String(), w.header)
+	}
+
+	w = &responseWriter{header: http.Header{}}
+	r := httptest.NewRequest("GET", "https://app.lorca/data", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	handler.ServeHTTP(w, r)
+	if w.status != 206 || w.body.String() != "234" || w.header.Get("Content-Range") != "bytes 2-4/10" {
+		t.Fatal(w.status, w.body.String(), w.header)
+	}
+
+	w = &responseWriter{header: http.Header{}}
+	w.Write([]byte("<html></html>"))
+	if ct := w.header.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatal(ct)
+	}
+}
+
+func TestResponseWriterFlush(t *testing.T) {
+	w := &responseWriter{header: http.Header{}}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Flush()
+	w.Write([]byte("data: 1\n\n"))
+	w.Flush()
+	w.Write([]byte("data: 2\n\n"))
+	if s := w.body.String(); s != "data: 1\n\ndata: 2\n\n" || w.status != 200 {
+		t.Fatal(s, w.status)
+	}
+}
+
+func TestResponseWriterStream(t *testing.T) {
+	pr, pw := io.Pipe()
+	w := &responseWriter{header: http.Header{}}
+	w.stream = func(w *responseWriter) (*io.PipeWriter, error) { return pw, nil }
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Write([]byte("data: 1\n\n"))
+	done := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(pr)
+		done <- string(b)
+	}()
+	w.Flush()
+	w.Write([]byte("data: 2\n\n"))
+	w.out.Close()
+	if s := <-done; s != "data: 1\n\ndata: 2\n\n" || w.body.Len() != 0 || w.status != 200 {
+		t.Fatal(s, w.body.Len(), w.status)
+	}
+}
+
+func TestStreamRelay(t *testing.T) {
+	r, err := newStreamRelay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	pr, pw := io.Pipe()
+	canceled := make(chan struct{})
+	s := &relayStream{
+		header:    http.Header{"Content-Type": {"text/event-stream"}},
+		status:    200,
+		body:      pr,
+		cancel:    func() { close(canceled) },
+		connected: make(chan struct{}),
+	}
+	token, err := r.add(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go pw.Write([]byte("data: 1\n\n"))
+	res, err := http.Get(r.url + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatal(ct)
+	}
+	// The event arrives while the response is still being written
+	if line, err := bufio.NewReader(res.Body).ReadString('\n'); line != "data: 1\n" {
+		t.Fatal(line, err)
+	}
+	// Handler is unblocked and canceled once the browser goes away
+	res.Body.Close()
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not canceled")
+	}
+	if _, err := pw.Write([]byte("data: 2\n\n")); err == nil {
+		t.Fatal("write after disconnect")
+	}
+	// Streams are served only once
+	if res, err := http.Get(r.url + token); err != nil || res.StatusCode != 404 {
+		t.Fatal(res, err)
+	}
+}
+
+func TestServeRecover(t *testing.T) {
+	w := &responseWriter{header: http.Header{}}
+	err := serveRecover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), w, httptest.NewRequest("GET", "https://app.lorca/", nil))
+	if err == nil || err.Error() != "boom" {
+		t.Fatal(err)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, "data: hello\n\n")
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprint(w, len(b))
+	})
+	if err := ui.Handle("https://app.lorca/", mux); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.Load("https://app.lorca/"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10 && ui.Eval(`location.origin`).String() != "https://app.lorca"; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if s := ui.Eval(`new Promise(resolve => {
+		const es = new EventSource('/events');
+		es.onmessage = e => { es.close(); resolve(e.data); };
+	})`).String(); s != "hello" {
+		t.Fatal(s)
+	}
+	if n := ui.Eval(`fetch('/panic').then(r => r.status)`).Int(); n != 500 {
+		t.Fatal(n)
+	}
+	size := 4 * 1024 * 1024
+	if n := ui.Eval(fmt.Sprintf(`fetch('/echo', {method: 'POST', body: 'x'.repeat(%d)}).then(r => r.text())`, size)).String(); n != fmt.Sprint(size) {
+		t.Fatal(n)
+	}
+}
+
+func TestHandleStream(t *testing.T) {
+	ui, err := NewWithOptions(Options{Headless: true, StreamRelay: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+		// The handler doesn't return until the test ends
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	if err := ui.Handle("https://app.lorca/", mux); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.Load("https://app.lorca/"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10 && ui.Eval(`location.origin`).String() != "https://app.lorca"; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if s := ui.Eval(`new Promise(resolve => {
+		const es = new EventSource('/events');
+		es.onmessage = e => { es.close(); resolve(e.data); };
+	})`).String(); s != "hello" {
+		t.Fatal(s)
+	}
+}
+
+func TestServeFS(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	files := fstest.MapFS{
+		"index.html": {Data: []byte("<html><body>Hello</body></html>")},
+		"app.js":     {Data: []byte("window.answer = 42")},
+	}
+	if err := ui.ServeFS("https://app.lorca/", files); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.Load("https://app.lorca/"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10 && ui.Eval(`location.origin`).String() != "https://app.lorca"; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if s := ui.Eval(`fetch('/index.html').then(r => r.text())`).String(); s != "<html><body>Hello</body></html>" {
+		t.Fatal(s)
+	}
+	if s := ui.Eval(`fetch('/app.js').then(r => r.headers.get('content-type'))`).String(); s != "text/javascript; charset=utf-8" {
+		t.Fatal(s)
+	}
+	if n := ui.Eval(`fetch('/missing').then(r => r.status)`).Int(); n != 404 {
+		t.Fatal(n)
+	}
+}
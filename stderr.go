@@ -0,0 +1,107 @@
+package lorca
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStartTimeout is returned if the browser doesn't become ready in time.
+var ErrStartTimeout = errors.New("timed out waiting for the browser")
+
+// defaultStartTimeout is how long the browser may take to start.
+const defaultStartTimeout = 30 * time.Second
+
+// stderrLines is how many last lines of the browser stderr are kept to be
+// reported if the browser fails to start.
+const stderrLines = 20
+
+// StartError is returned if the browser fails to start, e.g. because of
+// missing libraries, sandbox errors or a locked profile.
+type StartError struct {
+	// ExitCode is the exit status of the browser, -1 if it was still running
+	// or was killed by a signal.
+	ExitCode int
+	// Stderr are the last lines printed by the browser to stderr.
+	Stderr []string
+	// Discovery are the methods used to find the DevTools endpoint, set if
+	// none of them found it in time.
+	Discovery []Discovery
+	// PortFileErr is the error removing a stale DevToolsActivePort file,
+	// which disables the DevToolsActivePort discovery.
+	PortFileErr error
+	Err         error
+}
+
+func (e *StartError) Error() string {
+	s := "browser failed to start: " + e.Err.Error()
+	if e.PortFileErr != nil {
+		s = s + " (DevToolsActivePort discovery disabled: " + e.PortFileErr.Error() + ")"
+	}
+	if len(e.Stderr) > 0 {
+		s = s + "\n" + strings.Join(e.Stderr, "\n")
+	}
+	return s
+}
+
+func (e *StartError) Unwrap() error { return e.Err }
+
+// stderrLog keeps the last lines of the browser stderr, logs them at the
+// debug level and copies all the output to the writer, if any.
+type stderrLog struct {
+	mu    sync.Mutex
+	out   io.Writer
+	log   *slog.Logger
+	lines []string
+}
+
+func (l *stderrLog) write(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.out != nil {
+		io.WriteString(l.out, line)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	l.log.Debug("browser stderr", "line", line)
+	l.lines = append(l.lines, line)
+	if len(l.lines) > stderrLines {
+		l.lines = l.lines[len(l.lines)-stderrLines:]
+	}
+}
+
+func (l *stderrLog) tail() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string{}, l.lines...)
+}
+
+// readStderr reads the browser stderr until EOF. The first submatches of the
+// regexp are sent to the match channel, eof is closed when the output ends.
+func (l *stderrLog) read(r io.ReadCloser, re *regexp.Regexp) (match <-chan []string, eof <-chan struct{}) {
+	matchc, eofc := make(chan []string, 1), make(chan struct{})
+	go func() {
+		defer close(eofc)
+		defer r.Close()
+		br := bufio.NewReader(r)
+		found := false
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				l.write(line)
+				if m := re.FindStringSubmatch(line); m != nil && !found {
+					found = true
+					matchc <- m
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return matchc, eofc
+}
@@ -0,0 +1,80 @@
+//go:build !windows
+// +build !windows
+
+package lorca
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartError(t *testing.T) {
+	script := `for i in $(seq 1 30); do echo "line $i" >&2; done; exit 3`
+	_, err := newChrome(exec.Command("sh", "-c", script), Options{})
+	e := &StartError{}
+	if !errors.As(err, &e) {
+		t.Fatal(err)
+	}
+	if e.ExitCode != 3 {
+		t.Error(e.ExitCode)
+	}
+	if len(e.Stderr) != stderrLines || e.Stderr[0] != "line 11" || e.Stderr[stderrLines-1] != "line 30" {
+		t.Error(e.Stderr)
+	}
+	if !strings.Contains(err.Error(), "line 30") {
+		t.Error(err)
+	}
+}
+
+func TestStartTimeout(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	start := time.Now()
+	_, err := newChrome(exec.Command("sh", "-c", `echo starting >&2; sleep 30`), Options{
+		StartTimeout: 200 * time.Millisecond,
+		Stderr:       stderr,
+	})
+	if !errors.Is(err, ErrStartTimeout) {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("browser was not killed in time")
+	}
+	e := &StartError{}
+	if !errors.As(err, &e) || e.ExitCode != -1 || !reflect.DeepEqual(e.Stderr, []string{"starting"}) {
+		t.Error(err)
+	}
+	// Without a profile directory only stderr is watched
+	if !reflect.DeepEqual(e.Discovery, []Discovery{DiscoveryStderr}) || e.PortFileErr != nil {
+		t.Error(e.Discovery, e.PortFileErr)
+	}
+	if stderr.String() != "starting\n" {
+		t.Error(stderr.String())
+	}
+}
+
+func TestStartTimeoutStalePortFile(t *testing.T) {
+	// A directory in place of DevToolsActivePort can't be removed
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "DevToolsActivePort", "stale"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sh", "-c", "sleep 30", "sh", "--user-data-dir="+dir)
+	_, err := newChrome(cmd, Options{StartTimeout: 200 * time.Millisecond})
+	e := &StartError{}
+	if !errors.As(err, &e) || !errors.Is(err, ErrStartTimeout) {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(e.Discovery, []Discovery{DiscoveryStderr}) || e.PortFileErr == nil {
+		t.Fatal(e.Discovery, e.PortFileErr)
+	}
+	if !strings.Contains(err.Error(), "DevToolsActivePort") {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,173 @@
+package lorca
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Cookie is a browser cookie. When setting a cookie either URL or Domain must
+// be specified. Expires is a Unix time in seconds, zero or negative value
+// means a session cookie.
+type Cookie struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	URL      string  `json:"url,omitempty"`
+	Domain   string  `json:"domain,omitempty"`
+	Path     string  `json:"path,omitempty"`
+	Expires  float64 `json:"expires,omitempty"`
+	HTTPOnly bool    `json:"httpOnly,omitempty"`
+	Secure   bool    `json:"secure,omitempty"`
+	Session  bool    `json:"session,omitempty"`
+	SameSite string  `json:"sameSite,omitempty"`
+}
+
+// StorageType is a type of the origin data that can be cleared.
+type StorageType string
+
+const (
+	// StorageAll defines all types of the origin data
+	StorageAll StorageType = "all"
+	// StorageCookies defines cookies
+	StorageCookies StorageType = "cookies"
+	// StorageLocal defines localStorage
+	StorageLocal StorageType = "local_storage"
+	// StorageIndexedDB defines IndexedDB databases
+	StorageIndexedDB StorageType = "indexeddb"
+	// StorageCache defines Cache API storage
+	StorageCache StorageType = "cache_storage"
+	// StorageServiceWorkers defines registered service workers
+	StorageServiceWorkers StorageType = "service_workers"
+	// StorageFileSystems defines file systems
+	StorageFileSystems StorageType = "file_systems"
+)
+
+// StorageArea is a DOM storage area, either localStorage or sessionStorage.
+type StorageArea int
+
+const (
+	// LocalStorage defines window.localStorage
+	LocalStorage StorageArea = iota
+	// SessionStorage defines window.sessionStorage
+	SessionStorage
+)
+
+func (c *chrome) cookies(urls ...string) ([]Cookie, error) {
+	params := h{}
+	if len(urls) > 0 {
+		params["urls"] = urls
+	}
+	res, err := c.send("Network.getCookies", params)
+	if err != nil {
+		return nil, err
+	}
+	cookies := struct {
+		Cookies []Cookie `json:"cookies"`
+	}{}
+	err = json.Unmarshal(res, &cookies)
+	return cookies.Cookies, err
+}
+
+func (c *chrome) setCookies(cookies []Cookie) error {
+	params := []h{}
+	for _, cookie := range cookies {
+		p := h{"name": cookie.Name, "value": cookie.Value}
+		for k, v := range map[string]string{
+			"url": cookie.URL, "domain": cookie.Domain, "path": cookie.Path, "sameSite": cookie.SameSite,
+		} {
+			if v != "" {
+				p[k] = v
+			}
+		}
+		if cookie.Expires > 0 {
+			p["expires"] = cookie.Expires
+		}
+		if cookie.HTTPOnly {
+			p["httpOnly"] = true
+		}
+		if cookie.Secure {
+			p["secure"] = true
+		}
+		params = append(params, p)
+	}
+	_, err := c.send("Network.setCookies", h{"cookies": params})
+	return err
+}
+
+// deleteCookies deletes cookies by name, matching either URL or domain and
+// path of the given cookies.
+func (c *chrome) deleteCookies(cookies []Cookie) error {
+	for _, cookie := range cookies {
+		p := h{"name": cookie.Name}
+		for k, v := range map[string]string{"url": cookie.URL, "domain": cookie.Domain, "path": cookie.Path} {
+			if v != "" {
+				p[k] = v
+			}
+		}
+		if _, err := c.send("Network.deleteCookies", p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *chrome) clearBrowserCookies() error {
+	_, err := c.send("Network.clearBrowserCookies", nil)
+	return err
+}
+
+func (c *chrome) clearStorage(origin string, types []StorageType) error {
+	if len(types) == 0 {
+		types = []StorageType{StorageAll}
+	}
+	s := []string{}
+	for _, t := range types {
+		s = append(s, string(t))
+	}
+	_, err := c.send("Storage.clearDataForOrigin", h{
+		"origin":       storageOrigin(origin),
+		"storageTypes": strings.Join(s, ","),
+	})
+	return err
+}
+
+func storageID(origin string, area StorageArea) h {
+	return h{"securityOrigin": storageOrigin(origin), "isLocalStorage": area == LocalStorage}
+}
+
+// storageOrigin converts URL into an origin, other strings are kept as is.
+func storageOrigin(origin string) string {
+	if o := urlOrigin(origin); o != "" {
+		return o
+	}
+	return origin
+}
+
+func (c *chrome) storageItems(origin string, area StorageArea) (map[string]string, error) {
+	res, err := c.send("DOMStorage.getDOMStorageItems", h{"storageId": storageID(origin, area)})
+	if err != nil {
+		return nil, err
+	}
+	entries := struct {
+		Entries [][]string `json:"entries"`
+	}{}
+	if err := json.Unmarshal(res, &entries); err != nil {
+		return nil, err
+	}
+	items := map[string]string{}
+	for _, e := range entries.Entries {
+		if len(e) == 2 {
+			items[e[0]] = e[1]
+		}
+	}
+	return items, nil
+}
+
+func (c *chrome) setStorageItem(origin string, area StorageArea, key, value string) error {
+	_, err := c.send("DOMStorage.setDOMStorageItem", h{"storageId": storageID(origin, area), "key": key, "value": value})
+	return err
+}
+
+func (c *chrome) removeStorageItem(origin string, area StorageArea, key string) error {
+	_, err := c.send("DOMStorage.removeDOMStorageItem", h{"storageId": storageID(origin, area), "key": key})
+	return err
+}
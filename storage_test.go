@@ -0,0 +1,67 @@
+package lorca
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCookies(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	if err := ui.ServeFS("https://app.lorca/", fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.SetCookies([]Cookie{
+		{Name: "session", Value: "secret", URL: "https://app.lorca/", HTTPOnly: true},
+		{Name: "theme", Value: "dark", URL: "https://app.lorca/"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.Load("https://app.lorca/"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10 && ui.Eval(`location.origin`).String() != "https://app.lorca"; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if s := ui.Eval(`document.cookie`).String(); s != "theme=dark" {
+		t.Fatal(s)
+	}
+	cookies, err := ui.Cookies("https://app.lorca/")
+	if err != nil || len(cookies) != 2 {
+		t.Fatal(cookies, err)
+	}
+	if err := ui.DeleteCookies(Cookie{Name: "theme", URL: "https://app.lorca/"}); err != nil {
+		t.Fatal(err)
+	}
+	if cookies, err := ui.Cookies("https://app.lorca/"); err != nil || len(cookies) != 1 || !cookies[0].HTTPOnly {
+		t.Fatal(cookies, err)
+	}
+	if err := ui.ClearBrowserCookies(); err != nil {
+		t.Fatal(err)
+	}
+	if cookies, err := ui.Cookies("https://app.lorca/"); err != nil || len(cookies) != 0 {
+		t.Fatal(cookies, err)
+	}
+
+	if err := ui.SetStorageItem("https://app.lorca/", LocalStorage, "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if s := ui.Eval(`localStorage.getItem('foo')`).String(); s != "bar" {
+		t.Fatal(s)
+	}
+	ui.Eval(`sessionStorage.setItem('x', 'y')`)
+	if items, err := ui.StorageItems("https://app.lorca/", SessionStorage); err != nil || items["x"] != "y" {
+		t.Fatal(items, err)
+	}
+	if err := ui.ClearStorage("https://app.lorca/", StorageLocal); err != nil {
+		t.Fatal(err)
+	}
+	if items, err := ui.StorageItems("https://app.lorca/", LocalStorage); err != nil || len(items) != 0 {
+		t.Fatal(items, err)
+	}
+}
@@ -0,0 +1,336 @@
+package lorca
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// ExitReason tells why the UI has ended.
+type ExitReason string
+
+const (
+	// ExitClosed means that Close was called
+	ExitClosed ExitReason = "closed"
+	// ExitWindowClosed means that the user closed the browser window
+	ExitWindowClosed ExitReason = "windowClosed"
+	// ExitCrashed means that the page renderer process crashed. Without a
+	// supervisor the crashed page stays open until the UI ends for another
+	// reason, e.g. the user closes the window.
+	ExitCrashed ExitReason = "crashed"
+	// ExitDisconnected means that the connection to the browser failed while
+	// the browser was still running
+	ExitDisconnected ExitReason = "disconnected"
+	// ExitBrowserExited means that the browser process exited on its own, e.g.
+	// it crashed or was killed
+	ExitBrowserExited ExitReason = "browserExited"
+)
+
+// ExitError describes why the UI has ended.
+type ExitError struct {
+	Reason ExitReason
+	// ExitCode is the exit status of the browser process, -1 if it was
+	// killed by a signal.
+	ExitCode int
+	// Err is the underlying error, e.g. the connection error.
+	Err error
+}
+
+func (e *ExitError) Error() string {
+	switch e.Reason {
+	case ExitClosed:
+		return "ui closed"
+	case ExitWindowClosed:
+		return "window closed"
+	case ExitCrashed:
+		return "page crashed"
+	case ExitDisconnected:
+		return fmt.Sprintf("connection to the browser lost: %v", e.Err)
+	}
+	return fmt.Sprintf("browser exited with status %d", e.ExitCode)
+}
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// Supervisor restarts the browser if it crashes or exits unexpectedly, and
+// reloads the page if its renderer crashes. After a restart bindings, isolated
+// worlds, init scripts, request interception and other handlers are applied
+// again, window bounds are restored and the last URL is loaded.
+type Supervisor struct {
+	// MaxRestarts limits the number of restarts, zero means no limit.
+	MaxRestarts int
+	// OnCrash is called for every crash before the restart.
+	OnCrash func(CrashEvent)
+}
+
+// CrashEvent is reported by Supervisor.
+type CrashEvent struct {
+	Reason ExitReason
+	// ExitCode is the exit status of the browser process, if it has exited.
+	ExitCode int
+	// Restarts is the number of restarts so far, including this one.
+	Restarts int
+	// Err is non-nil if the browser can't be restarted and the UI ends.
+	Err error
+}
+
+// setExitReason records why the browser is about to exit, unless the reason
+// is already known.
+func (c *chrome) setExitReason(reason ExitReason, err error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.exitReason == "" {
+		c.exitReason, c.exitCause = reason, err
+	}
+}
+
+func (c *chrome) err() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.exitErr == nil {
+		return nil
+	}
+	return c.exitErr
+}
+
+// supervise enables restarts after crashes.
+func (c *chrome) supervise(s *Supervisor) {
+	c.Lock()
+	c.supervisor = s
+	c.Unlock()
+	if !c.headless {
+		// Window bounds are tracked to be restored after a restart
+		c.onWindowEvent(func(WindowEvent) {})
+	}
+}
+
+// wait waits for the browser to exit and either restarts it or ends the UI.
+func (c *chrome) wait() {
+	for {
+		c.Lock()
+		cmd, exited := c.cmd, c.exited
+		c.Unlock()
+		<-exited
+
+		c.Lock()
+		e := &ExitError{Reason: c.exitReason, ExitCode: -1, Err: c.exitCause}
+		c.Unlock()
+		if cmd != nil && cmd.ProcessState != nil {
+			e.ExitCode = cmd.ProcessState.ExitCode()
+		}
+		if e.Reason == "" {
+			e.Reason = ExitBrowserExited
+		}
+		if c.restart(cmd, e) {
+			continue
+		}
+		c.Lock()
+		c.exitErr = e
+		c.Unlock()
+		c.failPending(e)
+		c.closeRelay()
+		close(c.done)
+		return
+	}
+}
+
+// restart relaunches the browser with the same command line and restores the
+// page state. It returns false if the browser should not or can't be
+// restarted.
+func (c *chrome) restart(cmd *exec.Cmd, e *ExitError) bool {
+	if cmd == nil || e.Reason == ExitClosed || e.Reason == ExitWindowClosed {
+		// Replayed sessions have no browser to restart
+		return false
+	}
+	ev, ok := c.nextRestart(e.Reason)
+	if !ok {
+		return false
+	}
+	ev.ExitCode = e.ExitCode
+	c.failPending(e)
+	c.Lock()
+	c.exitReason, c.exitCause = "", nil
+	c.Unlock()
+
+	relaunch := &exec.Cmd{Path: cmd.Path, Args: cmd.Args, Env: cmd.Env, Dir: cmd.Dir}
+	err := c.start(relaunch)
+	if err == nil {
+		if err = c.restore(); err != nil {
+			c.kill()
+		}
+	}
+	ev.Err = err
+	if err != nil {
+		c.log.Error("browser restart failed", "reason", e.Reason, "exitCode", e.ExitCode, "error", err)
+	} else {
+		c.log.Warn("browser restarted", "reason", e.Reason, "exitCode", e.ExitCode, "restarts", ev.Restarts)
+	}
+	c.crashEvent(ev)
+	return err == nil
+}
+
+// nextRestart counts the restart and returns the crash event for it, or false
+// if no restart is allowed.
+func (c *chrome) nextRestart(reason ExitReason) (CrashEvent, bool) {
+	c.Lock()
+	defer c.Unlock()
+	s := c.supervisor
+	if s == nil || (s.MaxRestarts > 0 && c.restarts >= s.MaxRestarts) {
+		return CrashEvent{}, false
+	}
+	c.restarts++
+	return CrashEvent{Reason: reason, Restarts: c.restarts}, true
+}
+
+func (c *chrome) crashEvent(ev CrashEvent) {
+	c.Lock()
+	s := c.supervisor
+	c.Unlock()
+	if s != nil && s.OnCrash != nil {
+		s.OnCrash(ev)
+	}
+}
+
+// crashed is called when the page renderer crashes. Without a supervisor the
+// crash is only recorded and reported once the UI ends. If supervised, the
+// page is reloaded, or the UI ends when no restarts are left.
+func (c *chrome) crashed() {
+	c.Lock()
+	supervised := c.supervisor != nil
+	c.Unlock()
+	if !supervised {
+		c.setExitReason(ExitCrashed, nil)
+		return
+	}
+	ev, ok := c.nextRestart(ExitCrashed)
+	if !ok {
+		c.setExitReason(ExitCrashed, nil)
+		c.close()
+		return
+	}
+	_, ev.Err = c.send("Page.reload", nil)
+	c.log.Warn("page crashed, reloading", "restarts", ev.Restarts, "error", ev.Err)
+	c.crashEvent(ev)
+	if ev.Err != nil {
+		c.setExitReason(ExitCrashed, ev.Err)
+		c.close()
+	}
+}
+
+// disconnected is called when the connection to the browser fails. If the
+// browser doesn't exit shortly, it's no longer controllable and is killed.
+func (c *chrome) disconnected(conn transport, err error) {
+	c.Lock()
+	current, exited := c.conn == conn, c.exited
+	c.Unlock()
+	if !current {
+		return
+	}
+	c.failPending(err)
+	t := time.NewTimer(time.Second)
+	defer t.Stop()
+	select {
+	case <-exited:
+	case <-t.C:
+		c.setExitReason(ExitDisconnected, err)
+		c.kill()
+	}
+}
+
+// failPending fails all the commands waiting for a response.
+func (c *chrome) failPending(err error) {
+	c.Lock()
+	pending := c.pending
+	c.pending = map[int]chan result{}
+	c.Unlock()
+	for _, resc := range pending {
+		resc <- result{Err: err}
+	}
+}
+
+// trackURL remembers the URL of the page, to be loaded after a restart.
+func (c *chrome) trackURL() {
+	c.on("Page.frameNavigated", func(params json.RawMessage) {
+		ev := struct {
+			Frame struct {
+				ParentID string `json:"parentId"`
+				URL      string `json:"url"`
+			} `json:"frame"`
+		}{}
+		json.Unmarshal(params, &ev)
+		if ev.Frame.ParentID == "" {
+			c.Lock()
+			c.url = ev.Frame.URL
+			c.Unlock()
+		}
+	})
+}
+
+// restore applies the page setup again after the browser has been restarted.
+func (c *chrome) restore() error {
+	c.Lock()
+	bindings := []string{}
+	for name := range c.bindings {
+		bindings = append(bindings, name)
+	}
+	worlds := []*world{}
+	for _, w := range c.worlds {
+		worlds = append(worlds, w)
+	}
+	scripts := append([]*initScript{}, c.scripts...)
+	fetch, download, fileChooser := c.fetchEnabled, c.download, c.fileChooser
+	url, bounds := c.url, c.lastBounds
+	c.Unlock()
+
+	for _, name := range bindings {
+		if _, err := c.send("Runtime.addBinding", h{"name": name}); err != nil {
+			return err
+		}
+		if _, err := c.send("Page.addScriptToEvaluateOnNewDocument", h{"source": bindingScript(name)}); err != nil {
+			return err
+		}
+	}
+	for _, w := range worlds {
+		if err := w.restore(); err != nil {
+			return err
+		}
+	}
+	for _, s := range scripts {
+		res, err := c.send("Page.addScriptToEvaluateOnNewDocument", h{"source": s.source})
+		if err != nil {
+			return err
+		}
+		identifier := ""
+		json.Unmarshal(res, &struct {
+			Identifier *string `json:"identifier"`
+		}{&identifier})
+		c.Lock()
+		s.identifier = identifier
+		c.Unlock()
+	}
+	if fetch {
+		if err := c.enableFetch(); err != nil {
+			return err
+		}
+	}
+	if download != nil {
+		if err := c.onDownload(download); err != nil {
+			return err
+		}
+	}
+	if fileChooser != nil {
+		if err := c.onFileChooser(fileChooser); err != nil {
+			return err
+		}
+	}
+	if !c.headless && bounds.Width > 0 && bounds.Height > 0 {
+		if err := c.setBounds(bounds); err != nil {
+			return err
+		}
+	}
+	if url != "" {
+		return c.load(url)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package lorca
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExitReason(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.Err(); err != nil {
+		t.Fatal(err)
+	}
+	ui.Close()
+	select {
+	case <-ui.Done():
+	default:
+		t.Fatal("ui is not done after close")
+	}
+	e := &ExitError{}
+	if !errors.As(ui.Err(), &e) || e.Reason != ExitClosed {
+		t.Fatal(ui.Err())
+	}
+	if err := ui.Eval(`1`).Err(); err == nil {
+		t.Fatal("eval should fail after close")
+	}
+}
+
+func TestExitBrowserKilled(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+	killBrowser(ui)
+	select {
+	case <-ui.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("ui is not done")
+	}
+	e := &ExitError{}
+	if !errors.As(ui.Err(), &e) || (e.Reason != ExitBrowserExited && e.Reason != ExitDisconnected) {
+		t.Fatal(ui.Err())
+	}
+}
+
+func TestExitCrashed(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+	// Without a supervisor a renderer crash doesn't end the UI
+	ui.Load("chrome://crash")
+	select {
+	case <-ui.Done():
+		t.Fatal(ui.Err())
+	case <-time.After(time.Second):
+	}
+	ui.Close()
+	e := &ExitError{}
+	if !errors.As(ui.Err(), &e) || e.Reason != ExitCrashed {
+		t.Fatal(ui.Err())
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	crashes := make(chan CrashEvent, 10)
+	ui, err := NewWithOptions(Options{
+		Headless:   true,
+		Supervisor: &Supervisor{MaxRestarts: 2, OnCrash: func(e CrashEvent) { crashes <- e }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+	if err := ui.Bind("add", func(a, b int) int { return a + b }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ui.AddInitScript(`window.answer = 42`, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renderer crash reloads the page
+	ui.Load("chrome://crash")
+	if e := <-crashes; e.Reason != ExitCrashed || e.Restarts != 1 || e.Err != nil {
+		t.Fatal(e)
+	}
+
+	// Browser crash restarts the browser
+	killBrowser(ui)
+	if e := <-crashes; e.Reason == ExitCrashed || e.Restarts != 2 || e.Err != nil {
+		t.Fatal(e)
+	}
+	if n := ui.Eval(`add(2, 3)`).Int(); n != 5 {
+		t.Fatal(n)
+	}
+	if n := ui.Eval(`window.answer`).Int(); n != 42 {
+		t.Fatal(n)
+	}
+	if err := ui.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// No restarts left
+	killBrowser(ui)
+	<-ui.Done()
+	e := &ExitError{}
+	if !errors.As(ui.Err(), &e) || e.Reason == ExitClosed {
+		t.Fatal(ui.Err())
+	}
+}
+
+// killBrowser kills the browser process as if it crashed.
+func killBrowser(u UI) {
+	c := u.(*ui).chrome
+	c.Lock()
+	cmd := c.cmd
+	c.Unlock()
+	cmd.Process.Kill()
+}
@@ -0,0 +1,182 @@
+package lorca
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trace configures tracing of the DevTools protocol messages exchanged with
+// the page: commands, their responses and events.
+type Trace struct {
+	// Writer receives the trace as JSON lines, one TraceMessage per line. If
+	// it's nil, messages are logged by Options.Logger at the debug level.
+	Writer io.Writer
+	// MaxSize is the maximum size of params and results in bytes, longer ones
+	// are truncated. Zero means 4096, negative value means no limit.
+	MaxSize int
+	// Redact is called for every message before it's traced, it may modify
+	// the message, e.g. to hide credentials, or return false to skip it.
+	Redact func(m *TraceMessage) bool
+}
+
+// TraceMessageType is the type of a traced message.
+type TraceMessageType string
+
+const (
+	// TraceCommand is a command sent to the browser
+	TraceCommand TraceMessageType = "command"
+	// TraceResponse is a response to the command with the same ID
+	TraceResponse TraceMessageType = "response"
+	// TraceEvent is an event sent by the browser
+	TraceEvent TraceMessageType = "event"
+)
+
+// TraceMessage is a single traced protocol message.
+type TraceMessage struct {
+	Time    time.Time        `json:"time"`
+	Type    TraceMessageType `json:"type"`
+	ID      int              `json:"id,omitempty"`
+	Session string           `json:"session,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	// Latency is the time between the command and its response.
+	Latency time.Duration `json:"latency,omitempty"`
+	// Truncated is true if params or result exceed Trace.MaxSize.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+const defaultTraceMaxSize = 4096
+
+type tracedCommand struct {
+	method string
+	time   time.Time
+}
+
+// tracedID identifies a command, as the browser and the page session have
+// their own command IDs.
+type tracedID struct {
+	session string
+	id      int
+}
+
+// tracer writes protocol messages according to the trace options. Nil tracer
+// traces nothing.
+type tracer struct {
+	mu    sync.Mutex
+	trace Trace
+	log   *slog.Logger
+	enc   *json.Encoder
+	sent  map[tracedID]tracedCommand
+}
+
+func newTracer(t *Trace, log *slog.Logger) *tracer {
+	if t == nil {
+		return nil
+	}
+	tr := &tracer{trace: *t, log: log, sent: map[tracedID]tracedCommand{}}
+	if tr.trace.MaxSize == 0 {
+		tr.trace.MaxSize = defaultTraceMaxSize
+	}
+	if t.Writer != nil {
+		tr.enc = json.NewEncoder(t.Writer)
+	}
+	return tr
+}
+
+func (tr *tracer) command(id int, session, method string, params interface{}) {
+	if tr == nil {
+		return
+	}
+	now := time.Now()
+	tr.mu.Lock()
+	tr.sent[tracedID{session, id}] = tracedCommand{method: method, time: now}
+	tr.mu.Unlock()
+	b, _ := json.Marshal(params)
+	if string(b) == "null" {
+		b = nil
+	}
+	tr.write(&TraceMessage{Time: now, Type: TraceCommand, ID: id, Session: session, Method: method, Params: b})
+}
+
+func (tr *tracer) response(id int, session string, result json.RawMessage, err string) {
+	if tr == nil {
+		return
+	}
+	now := time.Now()
+	tr.mu.Lock()
+	cmd, ok := tr.sent[tracedID{session, id}]
+	delete(tr.sent, tracedID{session, id})
+	tr.mu.Unlock()
+	if !ok {
+		return
+	}
+	tr.write(&TraceMessage{
+		Time:    now,
+		Type:    TraceResponse,
+		ID:      id,
+		Session: session,
+		Method:  cmd.method,
+		Result:  result,
+		Error:   err,
+		Latency: now.Sub(cmd.time),
+	})
+}
+
+func (tr *tracer) event(session, method string, params json.RawMessage) {
+	if tr == nil {
+		return
+	}
+	tr.write(&TraceMessage{Time: time.Now(), Type: TraceEvent, Session: session, Method: method, Params: params})
+}
+
+func (tr *tracer) write(m *TraceMessage) {
+	if tr.trace.Redact != nil && !tr.trace.Redact(m) {
+		return
+	}
+	m.Params = tr.truncate(m.Params, &m.Truncated)
+	m.Result = tr.truncate(m.Result, &m.Truncated)
+	if tr.enc == nil {
+		attrs := []slog.Attr{slog.String("type", string(m.Type)), slog.String("method", m.Method)}
+		if m.ID != 0 {
+			attrs = append(attrs, slog.Int("id", m.ID))
+		}
+		if m.Session != "" {
+			attrs = append(attrs, slog.String("session", m.Session))
+		}
+		if m.Params != nil {
+			attrs = append(attrs, slog.String("params", string(m.Params)))
+		}
+		if m.Result != nil {
+			attrs = append(attrs, slog.String("result", string(m.Result)))
+		}
+		if m.Error != "" {
+			attrs = append(attrs, slog.String("error", m.Error))
+		}
+		if m.Type == TraceResponse {
+			attrs = append(attrs, slog.Duration("latency", m.Latency))
+		}
+		tr.log.LogAttrs(context.Background(), slog.LevelDebug, "cdp", attrs...)
+		return
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.enc.Encode(m)
+}
+
+// truncate replaces the JSON value longer than the maximum size with a JSON
+// string containing its beginning.
+func (tr *tracer) truncate(b json.RawMessage, truncated *bool) json.RawMessage {
+	if tr.trace.MaxSize < 0 || len(b) <= tr.trace.MaxSize {
+		return b
+	}
+	*truncated = true
+	s, _ := json.Marshal(strings.ToValidUTF8(string(b[:tr.trace.MaxSize]), "") + "...")
+	return s
+}
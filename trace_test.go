@@ -0,0 +1,106 @@
+package lorca
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tr := newTracer(&Trace{
+		Writer:  buf,
+		MaxSize: 24,
+		Redact: func(m *TraceMessage) bool {
+			if m.Method == "Network.setExtraHTTPHeaders" {
+				m.Params = json.RawMessage(`"redacted"`)
+			}
+			return m.Method != "Page.screencastFrame"
+		},
+	}, slog.Default())
+	tr.command(3, "s1", "Runtime.evaluate", h{"expression": "1+2"})
+	tr.response(3, "s1", json.RawMessage(`{"result":{"type":"number","value":3}}`), "")
+	tr.command(4, "s1", "Network.setExtraHTTPHeaders", h{"headers": h{"Authorization": "secret"}})
+	tr.response(4, "s1", nil, "failed")
+	tr.event("s1", "Page.screencastFrame", json.RawMessage(`{}`))
+	tr.event("", "Target.targetCreated", json.RawMessage(`{}`))
+
+	msgs := []TraceMessage{}
+	for s := bufio.NewScanner(buf); s.Scan(); {
+		m := TraceMessage{}
+		if err := json.Unmarshal(s.Bytes(), &m); err != nil {
+			t.Fatal(err, s.Text())
+		}
+		msgs = append(msgs, m)
+	}
+	if len(msgs) != 5 {
+		t.Fatal(msgs)
+	}
+	if m := msgs[0]; m.Type != TraceCommand || m.ID != 3 || m.Session != "s1" || string(m.Params) != `{"expression":"1+2"}` {
+		t.Error(m)
+	}
+	if m := msgs[1]; m.Type != TraceResponse || m.Method != "Runtime.evaluate" || !m.Truncated || string(m.Result) != `"{\"result\":{\"type\":\"numbe..."` {
+		t.Error(m, string(m.Result))
+	}
+	if m := msgs[2]; string(m.Params) != `"redacted"` || strings.Contains(buf.String(), "secret") {
+		t.Error(m)
+	}
+	if m := msgs[3]; m.Error != "failed" || m.Latency < 0 {
+		t.Error(m)
+	}
+	if m := msgs[4]; m.Type != TraceEvent || m.Method != "Target.targetCreated" || m.Session != "" {
+		t.Error(m)
+	}
+}
+
+func TestTracerLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	tr := newTracer(&Trace{}, log)
+	tr.command(3, "", "Page.navigate", h{"url": "about:blank"})
+	if s := buf.String(); !strings.Contains(s, "method=Page.navigate") || !strings.Contains(s, "about:blank") {
+		t.Error(s)
+	}
+	if tr := newTracer(nil, log); tr != nil {
+		t.Error(tr)
+	}
+}
+
+func TestTraceBrowserCommands(t *testing.T) {
+	rec := record(t, nil, func(c *chrome) {})
+	buf := &bytes.Buffer{}
+	u, err := Replay(bytes.NewReader(rec), ReplayOptions{Trace: &Trace{Writer: buf}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Close()
+	// The read loop may still trace late responses
+	tr := u.(*ui).chrome.tracer
+	tr.mu.Lock()
+	trace := append([]byte{}, buf.Bytes()...)
+	tr.mu.Unlock()
+	traced := map[string]bool{}
+	for s := bufio.NewScanner(bytes.NewReader(trace)); s.Scan(); {
+		m := TraceMessage{}
+		if err := json.Unmarshal(s.Bytes(), &m); err != nil {
+			t.Fatal(err, s.Text())
+		}
+		if m.Session == "" {
+			traced[string(m.Type)+" "+m.Method] = true
+		}
+	}
+	for _, want := range []string{
+		"command Target.setDiscoverTargets",
+		"event Target.targetCreated",
+		"command Target.attachToTarget",
+		"response Target.attachToTarget",
+		"command Browser.close",
+	} {
+		if !traced[want] {
+			t.Error(want, traced)
+		}
+	}
+}
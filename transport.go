@@ -0,0 +1,112 @@
+package lorca
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// transport carries raw DevTools protocol messages to and from the browser.
+type transport interface {
+	Send(b []byte) error
+	Receive() ([]byte, error)
+	Close() error
+}
+
+type wsTransport struct {
+	ws *websocket.Conn
+}
+
+func (t *wsTransport) Send(b []byte) error { return websocket.Message.Send(t.ws, string(b)) }
+
+func (t *wsTransport) Receive() ([]byte, error) {
+	var b []byte
+	err := websocket.Message.Receive(t.ws, &b)
+	return b, err
+}
+
+func (t *wsTransport) Close() error { return t.ws.Close() }
+
+func sendJSON(t transport, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.Send(b)
+}
+
+func receiveJSON(t transport, v interface{}) error {
+	b, err := t.Receive()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// recordDirection tells if a recorded message has been sent or received.
+type recordDirection string
+
+const (
+	recordStart   recordDirection = "start"
+	recordSend    recordDirection = "send"
+	recordReceive recordDirection = "recv"
+)
+
+// recordEntry is a single line of a recorded session. Every connection to
+// the browser starts with a "start" entry, followed by the messages
+// exchanged.
+type recordEntry struct {
+	Time     time.Time       `json:"time"`
+	Dir      recordDirection `json:"dir"`
+	Headless bool            `json:"headless,omitempty"`
+	Message  json.RawMessage `json:"message,omitempty"`
+}
+
+// recordWriter writes recorded messages as JSON lines. It's shared by all
+// the connections of a browser, as a restarted browser records into the
+// same writer.
+type recordWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newRecordWriter(w io.Writer) *recordWriter {
+	if w == nil {
+		return nil
+	}
+	return &recordWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *recordWriter) write(e recordEntry) {
+	e.Time = time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enc.Encode(e)
+}
+
+// recorder records all the messages passing through the transport.
+type recorder struct {
+	transport
+	w *recordWriter
+}
+
+func newRecorder(t transport, w *recordWriter, headless bool) *recorder {
+	w.write(recordEntry{Dir: recordStart, Headless: headless})
+	return &recorder{transport: t, w: w}
+}
+
+func (r *recorder) Send(b []byte) error {
+	r.w.write(recordEntry{Dir: recordSend, Message: b})
+	return r.transport.Send(b)
+}
+
+func (r *recorder) Receive() ([]byte, error) {
+	b, err := r.transport.Receive()
+	if err == nil {
+		r.w.write(recordEntry{Dir: recordReceive, Message: b})
+	}
+	return b, err
+}
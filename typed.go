@@ -0,0 +1,64 @@
+package lorca
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Evaluator evaluates JS code and binds Go functions to JS. UI implements
+// this interface.
+type Evaluator interface {
+	Eval(js string) Value
+	Bind(name string, f interface{}) error
+}
+
+// EvalAs evaluates JS expression and converts the result into a value of type
+// T, following the same rules as Value.To(). If the expression results in
+// undefined - a zero value of T is returned.
+func EvalAs[T any](e Evaluator, js string) (T, error) {
+	return valueAs[T](e.Eval(js))
+}
+
+// CallAs calls JS function fn with the given arguments and converts the
+// result into a value of type T. Arguments are encoded as JSON, fn may be any
+// JS expression that evaluates to a function, e.g. "document.querySelector".
+func CallAs[T any](e Evaluator, fn string, args ...interface{}) (T, error) {
+	js, err := callExpr(fn, args)
+	if err != nil {
+		var x T
+		return x, err
+	}
+	return EvalAs[T](e, js)
+}
+
+// callExpr returns JS expression that calls fn with JSON-encoded arguments.
+func callExpr(fn string, args []interface{}) (string, error) {
+	params := make([]string, len(args))
+	for i, arg := range args {
+		b, err := json.Marshal(arg)
+		if err != nil {
+			return "", err
+		}
+		params[i] = string(b)
+	}
+	return fmt.Sprintf("(%s)(%s)", fn, strings.Join(params, ",")), nil
+}
+
+// BindFunc binds a Go function with a single argument to JS. It's equivalent
+// to Bind, but the function signature is checked at compile time.
+func BindFunc[A, R any](e Evaluator, name string, f func(A) (R, error)) error {
+	return e.Bind(name, f)
+}
+
+func valueAs[T any](v Value) (T, error) {
+	var x T
+	if err := v.Err(); err != nil {
+		return x, err
+	}
+	if n, ok := v.(NativeValue); ok && n.Undefined() {
+		return x, nil
+	}
+	err := v.To(&x)
+	return x, err
+}
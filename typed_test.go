@@ -0,0 +1,76 @@
+package lorca
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type fakeEvaluator struct {
+	js    string
+	value value
+	name  string
+	f     interface{}
+}
+
+func (e *fakeEvaluator) Eval(js string) Value { e.js = js; return e.value }
+func (e *fakeEvaluator) Bind(name string, f interface{}) error {
+	e.name, e.f = name, f
+	return nil
+}
+
+func TestEvalAs(t *testing.T) {
+	e := &fakeEvaluator{value: value{raw: json.RawMessage(`{"x":5,"y":"foo"}`)}}
+	p, err := EvalAs[struct {
+		X int
+		Y string
+	}](e, `({x: 5, y: 'foo'})`)
+	if err != nil || p.X != 5 || p.Y != "foo" {
+		t.Fatal(p, err)
+	}
+
+	e.value = value{err: errTest}
+	if _, err := EvalAs[int](e, `throw 'fail'`); err != errTest {
+		t.Fatal(err)
+	}
+
+	e.value = value{raw: json.RawMessage(`"foo"`)}
+	if _, err := EvalAs[int](e, `'foo'`); err == nil {
+		t.Fatal(err)
+	}
+
+	e.value = (&deepValue{Type: "undefined"}).value()
+	if n, err := EvalAs[int](e, `undefined`); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+}
+
+func TestCallAs(t *testing.T) {
+	e := &fakeEvaluator{value: value{raw: json.RawMessage(`5`)}}
+	if n, err := CallAs[int](e, "window.add", 2, 3); err != nil || n != 5 {
+		t.Fatal(n, err)
+	}
+	if e.js != `(window.add)(2,3)` {
+		t.Fatal(e.js)
+	}
+	if _, err := CallAs[int](e, "f", func() {}); err == nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBindFunc(t *testing.T) {
+	e := &fakeEvaluator{}
+	if err := BindFunc(e, "double", func(n int) (int, error) {
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return n * 2, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := e.f.(func(int) (int, error)); e.name != "double" || !ok {
+		t.Fatal(e.name, e.f)
+	} else if n, _ := f(21); n != 42 {
+		t.Fatal(n)
+	}
+}
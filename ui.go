@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"os/exec"
 	"reflect"
+	"strings"
 )
 
 // UI interface allows talking to the HTML5 UI from Go.
@@ -16,7 +20,96 @@ type UI interface {
 	SetBounds(Bounds) error
 	Bind(name string, f interface{}) error
 	Eval(js string) Value
+	// IsolatedWorld returns an isolated JS world with the given name, creating
+	// it on the first call. Names starting with "__lorca" are reserved.
+	IsolatedWorld(name string) (World, error)
+	// AddInitScript registers JS code that is evaluated in every new document
+	// before any page scripts, so it survives navigation and reloads. If now is
+	// true the code is also evaluated in the current document. The returned ID
+	// can be passed to RemoveInitScript only, not to RemoveStyleSheet.
+	AddInitScript(js string, now bool) (string, error)
+	RemoveInitScript(id string) error
+	// AddStyleSheet registers CSS that is applied to every new document before
+	// it is rendered. If now is true the stylesheet is also applied to the
+	// current document. RemoveStyleSheet removes it from the current document
+	// as well, it doesn't accept IDs of init scripts.
+	AddStyleSheet(css string, now bool) (string, error)
+	RemoveStyleSheet(id string) error
+	// Handle serves all requests to the origin (e.g. "https://app.lorca/") with
+	// the HTTP handler in-process, without opening any network sockets.
+	// Responses are delivered once the handler returns, unless
+	// Options.StreamRelay is set: then responses flushed by the handler
+	// (http.Flusher) are streamed through a relay listening on 127.0.0.1. A
+	// panicking handler responds with 500 Internal Server Error.
+	Handle(origin string, h http.Handler) error
+	// ServeFS serves files from fsys at the origin, see Handle.
+	ServeFS(origin string, fsys fs.FS) error
+	// Intercept calls f for every request with URL matching the pattern, where
+	// '*' matches zero or more characters and '?' matches exactly one.
+	Intercept(pattern string, f func(r *InterceptedRequest)) error
+	// OnAuthRequired sets a function that answers HTTP authentication
+	// challenges, returning false cancels the authentication.
+	OnAuthRequired(f func(AuthChallenge) (user, password string, ok bool)) error
+	// SetNetworkPolicy restricts network access of the page, nil removes the
+	// restrictions. It fails if any of the allowed origins is malformed.
+	SetNetworkPolicy(p *NetworkPolicy) error
+	// StartHAR starts recording the page network traffic, StopHAR stops it and
+	// returns the recorded HTTP archive.
+	StartHAR(opts HAROptions) error
+	StopHAR() (*HAR, error)
+	// Cookies returns cookies for the given URLs, or for the current page if no
+	// URLs are given. HttpOnly cookies are included.
+	Cookies(urls ...string) ([]Cookie, error)
+	SetCookies(cookies []Cookie) error
+	// DeleteCookies deletes cookies with matching name and URL or domain/path.
+	DeleteCookies(cookies ...Cookie) error
+	ClearBrowserCookies() error
+	// ClearStorage clears the data of the given types for the origin, all the
+	// data is cleared if no types are given.
+	ClearStorage(origin string, types ...StorageType) error
+	// StorageItems returns all items of localStorage or sessionStorage of the
+	// origin.
+	StorageItems(origin string, area StorageArea) (map[string]string, error)
+	SetStorageItem(origin string, area StorageArea, key, value string) error
+	RemoveStorageItem(origin string, area StorageArea, key string) error
+	// OnDownload sets a function that is called for every file download started
+	// by the page, nil restores the default browser behavior. Close waits for
+	// the accepted downloads that are still being saved.
+	OnDownload(f func(d *Download)) error
+	// OnFileChooser sets a function that selects files instead of the browser
+	// file chooser. Returning an error or no files cancels the selection, nil
+	// function restores the browser file chooser.
+	OnFileChooser(f func(FileChooserRequest) ([]string, error)) error
+	// OnJavaScriptDialog sets a function that handles alert(), confirm(),
+	// prompt() and beforeunload dialogs, returning whether the dialog is
+	// accepted and the prompt text. Nil function restores the default
+	// behavior, which is HeadlessJSDialogs in headless mode.
+	OnJavaScriptDialog(f func(JSDialog) (accept bool, text string)) error
+	// OnWindowEvent adds a function that is called when the window is moved,
+	// resized, maximized, minimized or restored, and when the page is shown,
+	// hidden, focused or blurred.
+	OnWindowEvent(f func(WindowEvent)) error
+	// Focus restores the window if it's minimized and brings it to front.
+	Focus() error
+	// BringToFront brings the window to front.
+	BringToFront() error
+	// Screens returns the displays connected to the computer. If the browser
+	// can't enumerate them, only the screen of the window is returned.
+	Screens() ([]Screen, error)
+	// Center moves the window to the center of the screen it's on.
+	Center() error
+	// MoveToScreen moves the window to the center of the screen with the given
+	// index in the list returned by Screens, keeping its size and state.
+	MoveToScreen(i int) error
+	// Version returns the browser version, see also Version.Unsupported.
+	Version() (Version, error)
 	Done() <-chan struct{}
+	// Endpoint returns the DevTools endpoint of the browser and how it was
+	// found.
+	Endpoint() Endpoint
+	// Err returns nil until Done is closed, then it returns an *ExitError
+	// telling why the UI has ended.
+	Err() error
 	Close() error
 }
 
@@ -52,7 +145,6 @@ var defaultChromeArgs = []string{
 	"--enable-automation",
 	"--password-store=basic",
 	"--use-mock-keychain",
-	"--remote-allow-origins=*",
 }
 
 // New returns a new HTML5 UI for the given URL, user profile directory, window
@@ -60,12 +152,32 @@ var defaultChromeArgs = []string{
 // string - a blank page is displayed. If user profile directory is an empty
 // string - a temporary directory is created and it will be removed on
 // ui.Close(). You might want to use "--headless" custom CLI argument to test
-// your UI code.
+// your UI code. See NewWithOptions for more options.
 func New(url, dir string, width, height int, customArgs ...string) (UI, error) {
-	if url == "" {
-		url = "data:text/html,<html></html>"
+	return NewWithOptions(Options{
+		URL:        url,
+		ProfileDir: dir,
+		Bounds:     Bounds{Width: width, Height: height},
+		ExtraArgs:  customArgs,
+	})
+}
+
+// NewWithOptions returns a new HTML5 UI configured with the given options.
+func NewWithOptions(o Options) (UI, error) {
+	exe := o.Executable
+	if exe == "" && (o.Policy.MinVersion > 0 || len(o.Policy.Products) > 0) {
+		b, err := SelectBrowser(o.Policy)
+		if err != nil {
+			return nil, err
+		}
+		exe = b.Path
+	} else if exe == "" {
+		exe = ChromeExecutable()
+	}
+	if exe == "" {
+		return nil, &BrowserNotFoundError{Searched: browserCandidates()}
 	}
-	tmpDir := ""
+	dir, tmpDir := o.ProfileDir, ""
 	if dir == "" {
 		name, err := ioutil.TempDir("", "lorca")
 		if err != nil {
@@ -73,33 +185,58 @@ func New(url, dir string, width, height int, customArgs ...string) (UI, error) {
 		}
 		dir, tmpDir = name, name
 	}
-	args := append(defaultChromeArgs, fmt.Sprintf("--app=%s", url))
-	args = append(args, fmt.Sprintf("--user-data-dir=%s", dir))
-	args = append(args, fmt.Sprintf("--window-size=%d,%d", width, height))
-	args = append(args, customArgs...)
-	args = append(args, "--remote-debugging-port=0")
+	cmd := exec.Command(exe, o.args(dir)...)
+	cmd.Dir = o.WorkingDir
+	if len(o.Env) > 0 {
+		cmd.Env = append(os.Environ(), o.Env...)
+	}
 
-	chrome, err := newChromeWithArgs(ChromeExecutable(), args...)
-	done := make(chan struct{})
+	chrome, err := newChrome(cmd, o)
+	if err == nil {
+		if err = chrome.checkVersion(o.Policy.MinVersion); err != nil {
+			chrome.kill()
+		}
+	}
 	if err != nil {
+		if tmpDir != "" {
+			os.RemoveAll(tmpDir)
+		}
 		return nil, err
 	}
 
-	go func() {
-		chrome.cmd.Wait()
-		close(done)
-	}()
-	return &ui{chrome: chrome, done: done, tmpDir: tmpDir}, nil
+	if o.Supervisor != nil {
+		chrome.supervise(o.Supervisor)
+	}
+	return &ui{chrome: chrome, done: chrome.done, tmpDir: tmpDir}, nil
 }
 
 func (u *ui) Done() <-chan struct{} {
 	return u.done
 }
 
+func (u *ui) Err() error { return u.chrome.err() }
+
+func (u *ui) Endpoint() Endpoint {
+	u.chrome.Lock()
+	defer u.chrome.Unlock()
+	return u.chrome.endpoint
+}
+
 func (u *ui) Close() error {
 	// ignore err, as the chrome process might be already dead, when user close the window.
-	u.chrome.kill()
+	u.chrome.setExitReason(ExitClosed, nil)
+	u.chrome.close()
 	<-u.done
+	u.chrome.saving.Wait()
+	u.chrome.Lock()
+	downloads, closers := u.chrome.downloadDir, u.chrome.closers
+	u.chrome.Unlock()
+	for _, f := range closers {
+		f()
+	}
+	if downloads != "" {
+		os.RemoveAll(downloads)
+	}
 	if u.tmpDir != "" {
 		if err := os.RemoveAll(u.tmpDir); err != nil {
 			return err
@@ -108,20 +245,37 @@ func (u *ui) Close() error {
 	return nil
 }
 
+// onClose adds a function that Close calls once the browser has exited.
+func (u *ui) onClose(f func()) {
+	u.chrome.Lock()
+	u.chrome.closers = append(u.chrome.closers, f)
+	u.chrome.Unlock()
+}
+
 func (u *ui) Load(url string) error { return u.chrome.load(url) }
 
 func (u *ui) Bind(name string, f interface{}) error {
+	binding, err := newBinding(f)
+	if err != nil {
+		return err
+	}
+	return u.chrome.bind(name, binding)
+}
+
+// newBinding wraps a Go function into a binding that decodes JSON arguments
+// and calls the function using reflection.
+func newBinding(f interface{}) (bindingFunc, error) {
 	v := reflect.ValueOf(f)
 	// f must be a function
 	if v.Kind() != reflect.Func {
-		return errors.New("only functions can be bound")
+		return nil, errors.New("only functions can be bound")
 	}
 	// f must return either value and error or just error
 	if n := v.Type().NumOut(); n > 2 {
-		return errors.New("function may only return a value or a value+error")
+		return nil, errors.New("function may only return a value or a value+error")
 	}
 
-	return u.chrome.bind(name, func(raw []json.RawMessage) (interface{}, error) {
+	return func(raw []json.RawMessage) (interface{}, error) {
 		if len(raw) != v.Type().NumIn() {
 			return nil, errors.New("function arguments mismatch")
 		}
@@ -160,12 +314,115 @@ func (u *ui) Bind(name string, f interface{}) error {
 		default:
 			return nil, errors.New("unexpected number of return values")
 		}
-	})
+	}, nil
 }
 
 func (u *ui) Eval(js string) Value {
-	v, err := u.chrome.eval(js)
-	return value{err: err, raw: v}
+	return u.chrome.evalValue(js)
+}
+
+func (u *ui) IsolatedWorld(name string) (World, error) {
+	if strings.HasPrefix(name, reservedWorldPrefix) {
+		return nil, fmt.Errorf("world name %q is reserved", name)
+	}
+	w, err := u.chrome.isolatedWorld(name)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (u *ui) AddInitScript(js string, now bool) (string, error) {
+	return u.chrome.addInitScript(js, now)
+}
+
+func (u *ui) RemoveInitScript(id string) error {
+	return u.chrome.removeInitScript(id)
+}
+
+func (u *ui) AddStyleSheet(css string, now bool) (string, error) {
+	return u.chrome.addStyleSheet(css, now)
+}
+
+func (u *ui) RemoveStyleSheet(id string) error {
+	return u.chrome.removeStyleSheet(id)
+}
+
+func (u *ui) Handle(origin string, h http.Handler) error {
+	return u.chrome.handle(origin, h)
+}
+
+func (u *ui) ServeFS(origin string, fsys fs.FS) error {
+	return u.chrome.handle(origin, http.FileServer(http.FS(fsys)))
+}
+
+func (u *ui) Intercept(pattern string, f func(r *InterceptedRequest)) error {
+	return u.chrome.intercept(pattern, f)
+}
+
+func (u *ui) OnAuthRequired(f func(AuthChallenge) (string, string, bool)) error {
+	return u.chrome.setAuthHandler(f)
+}
+
+func (u *ui) SetNetworkPolicy(p *NetworkPolicy) error {
+	return u.chrome.setNetworkPolicy(p)
+}
+
+func (u *ui) StartHAR(opts HAROptions) error { return u.chrome.startHAR(opts) }
+
+func (u *ui) StopHAR() (*HAR, error) { return u.chrome.stopHAR() }
+
+func (u *ui) Cookies(urls ...string) ([]Cookie, error) { return u.chrome.cookies(urls...) }
+
+func (u *ui) SetCookies(cookies []Cookie) error { return u.chrome.setCookies(cookies) }
+
+func (u *ui) DeleteCookies(cookies ...Cookie) error { return u.chrome.deleteCookies(cookies) }
+
+func (u *ui) ClearBrowserCookies() error { return u.chrome.clearBrowserCookies() }
+
+func (u *ui) ClearStorage(origin string, types ...StorageType) error {
+	return u.chrome.clearStorage(origin, types)
+}
+
+func (u *ui) StorageItems(origin string, area StorageArea) (map[string]string, error) {
+	return u.chrome.storageItems(origin, area)
+}
+
+func (u *ui) SetStorageItem(origin string, area StorageArea, key, value string) error {
+	return u.chrome.setStorageItem(origin, area, key, value)
+}
+
+func (u *ui) RemoveStorageItem(origin string, area StorageArea, key string) error {
+	return u.chrome.removeStorageItem(origin, area, key)
+}
+
+func (u *ui) OnDownload(f func(d *Download)) error { return u.chrome.onDownload(f) }
+
+func (u *ui) OnFileChooser(f func(FileChooserRequest) ([]string, error)) error {
+	return u.chrome.onFileChooser(f)
+}
+
+func (u *ui) OnJavaScriptDialog(f func(JSDialog) (bool, string)) error {
+	return u.chrome.onJavaScriptDialog(f)
+}
+
+func (u *ui) OnWindowEvent(f func(WindowEvent)) error { return u.chrome.onWindowEvent(f) }
+
+func (u *ui) Focus() error { return u.chrome.focus() }
+
+func (u *ui) BringToFront() error { return u.chrome.bringToFront() }
+
+func (u *ui) Version() (Version, error) { return u.chrome.version() }
+
+func (u *ui) Screens() ([]Screen, error) { return u.chrome.screens() }
+
+func (u *ui) Center() error { return u.chrome.center(-1) }
+
+func (u *ui) MoveToScreen(i int) error {
+	if i < 0 {
+		return fmt.Errorf("invalid screen index %d", i)
+	}
+	return u.chrome.center(i)
 }
 
 func (u *ui) SetBounds(b Bounds) error {
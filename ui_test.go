@@ -2,9 +2,12 @@ package lorca
 
 import (
 	"errors"
+	"math"
 	"math/rand"
 	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestEval(t *testing.T) {
@@ -26,6 +29,34 @@ func TestEval(t *testing.T) {
 		t.Fatal(a)
 	}
 
+	if v := ui.Eval(`undefined`).(NativeValue); !v.Undefined() {
+		t.Fatal(v)
+	}
+
+	if f := ui.Eval(`NaN`).Float(); !math.IsNaN(float64(f)) {
+		t.Fatal(f)
+	}
+
+	if n := ui.Eval(`2n ** 64n`).(NativeValue).BigInt(); n == nil || n.String() != "18446744073709551616" {
+		t.Fatal(n)
+	}
+
+	// Objects that can't be serialized are empty, like with JSON serialization
+	if b := string(ui.Eval(`document.body`).Bytes()); b != `{}` {
+		t.Fatal(b)
+	}
+	if b := string(ui.Eval(`({a: 1, f() {}})`).Bytes()); b != `{"a":1,"f":{}}` {
+		t.Fatal(b)
+	}
+
+	if d := ui.Eval(`new Date(Date.UTC(2020, 0, 2))`).(NativeValue).Time(); !d.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatal(d)
+	}
+
+	if m, ok := ui.Eval(`new Map([[1, 'a'], ['b', 2]])`).(NativeValue).Interface().(Map); !ok || len(m) != 2 || m[0].Key != float64(1) {
+		t.Fatal(m)
+	}
+
 	// XXX this probably should be unquoted?
 	if err := ui.Eval(`throw "fail"`).Err(); err.Error() != `"fail"` {
 		t.Fatal(err)
@@ -150,3 +181,144 @@ func TestFunctionReturnTypes(t *testing.T) {
 		t.Fatal(v)
 	}
 }
+
+func TestIsolatedWorld(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	w, err := ui.IsolatedWorld("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Bind("mul", func(a, b int) int { return a * b }); err != nil {
+		t.Fatal(err)
+	}
+
+	ui.Eval(`window.foo = 42; document.title = 'shared'`)
+	if v := w.Eval(`window.foo`).(NativeValue); !v.Undefined() {
+		t.Fatal(v)
+	}
+	if s := w.Eval(`document.title`).String(); s != "shared" {
+		t.Fatal(s)
+	}
+	if n := w.Call("mul", 2, 3).Int(); n != 6 {
+		t.Fatal(n)
+	}
+	if s := ui.Eval(`typeof mul`).String(); s != "undefined" {
+		t.Fatal(s)
+	}
+
+	if err := ui.Load("data:text/html,<html><title>reloaded</title></html>"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10 && w.Eval(`document.title`).String() != "reloaded"; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := w.Eval(`mul(3, 4)`).Int(); n != 12 {
+		t.Fatal(n)
+	}
+}
+
+func TestIsolatedWorldRetry(t *testing.T) {
+	// The first world creation fails, the second one must not return the
+	// broken world
+	var worlds int32
+	record(t, func(method string) bool {
+		return method == "Page.createIsolatedWorld" && atomic.AddInt32(&worlds, 1) == 1
+	}, func(c *chrome) {
+		if _, err := c.isolatedWorld("test"); err == nil {
+			t.Fatal("world creation did not fail")
+		}
+		c.Lock()
+		n := len(c.handlers["Runtime.executionContextCreated"])
+		c.Unlock()
+		if _, err := c.isolatedWorld("test"); err != nil {
+			t.Fatal(err)
+		}
+		if n := atomic.LoadInt32(&worlds); n != 2 {
+			t.Fatal(n)
+		}
+		// Only the created world listens for its execution contexts
+		c.Lock()
+		defer c.Unlock()
+		if m := len(c.handlers["Runtime.executionContextCreated"]); m != n+1 {
+			t.Fatal(n, m)
+		}
+	})
+}
+
+func TestInitScripts(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	id, err := ui.AddInitScript(`window.answer = 42`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ui.Eval(`window.answer`).Int(); n != 42 {
+		t.Fatal(n)
+	}
+	css, err := ui.AddStyleSheet(`body { color: rgb(1, 2, 3); }`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ui.Load("data:text/html,<html><body>Hello</body></html>"); err != nil {
+		t.Fatal(err)
+	}
+	color := `document.body ? getComputedStyle(document.body).color : ''`
+	for i := 0; i < 10 && ui.Eval(color).String() == ""; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := ui.Eval(`window.answer`).Int(); n != 42 {
+		t.Fatal(n)
+	}
+	if s := ui.Eval(color).String(); s != "rgb(1, 2, 3)" {
+		t.Fatal(s)
+	}
+
+	if err := ui.RemoveStyleSheet(css); err != nil {
+		t.Fatal(err)
+	}
+	if s := ui.Eval(color).String(); s == "rgb(1, 2, 3)" {
+		t.Fatal(s)
+	}
+	if err := ui.RemoveInitScript(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.RemoveInitScript(id); err == nil {
+		t.Fatal("init script removed twice")
+	}
+}
+
+func TestInitScriptKinds(t *testing.T) {
+	record(t, nil, func(c *chrome) {
+		script, err := c.addInitScript("window.x = 1", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sheet, err := c.addStyleSheet("body { color: red }", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// IDs of init scripts and stylesheets are not interchangeable
+		if err := c.removeStyleSheet(script); err == nil {
+			t.Fatal("init script removed as a stylesheet")
+		}
+		if err := c.removeInitScript(sheet); err == nil {
+			t.Fatal("stylesheet removed as an init script")
+		}
+		if err := c.removeInitScript(script); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.removeStyleSheet(sheet); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
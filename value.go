@@ -1,6 +1,13 @@
 package lorca
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/big"
+	"reflect"
+	"time"
+)
 
 // Value is a generic type of a JSON value (primitive, object, array) and
 // optionally an error value.
@@ -16,19 +23,102 @@ type Value interface {
 	Bytes() []byte
 }
 
+// NativeValue is a Value that also keeps JS values that have no JSON
+// representation. Values returned by Eval implement it.
+type NativeValue interface {
+	Value
+	// Interface returns the value converted into the closest Go type. Unlike
+	// To() into an interface{} it preserves JS values that have no JSON
+	// representation: undefined becomes Undefined, NaN and Infinity become
+	// float64, BigInt becomes *big.Int, Date becomes time.Time, Map and Set
+	// become Map and Set.
+	Interface() interface{}
+	Undefined() bool
+	Time() time.Time
+	BigInt() *big.Int
+}
+
+// Undefined is a Go counterpart of the JavaScript undefined value.
+type Undefined struct{}
+
+// MapEntry is a single key-value pair of a JavaScript Map.
+type MapEntry struct {
+	Key   interface{} `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// Map is a JavaScript Map with the original insertion order preserved. Keys
+// may be of any type, not only strings.
+type Map []MapEntry
+
+// Set is a JavaScript Set with the original insertion order preserved.
+type Set []interface{}
+
+// RegExp is a JavaScript regular expression.
+type RegExp struct {
+	Pattern string `json:"pattern"`
+	Flags   string `json:"flags,omitempty"`
+}
+
 type value struct {
-	err error
-	raw json.RawMessage
+	err  error
+	raw  json.RawMessage
+	deep *deepValue
 }
 
-func (v value) Err() error             { return v.err }
-func (v value) Bytes() []byte          { return v.raw }
-func (v value) To(x interface{}) error { return json.Unmarshal(v.raw, x) }
-func (v value) Float() (f float32)     { v.To(&f); return f }
-func (v value) Int() (i int)           { v.To(&i); return i }
-func (v value) String() (s string)     { v.To(&s); return s }
-func (v value) Bool() (b bool)         { v.To(&b); return b }
+// deepValue is a value serialized by Chrome according to the WebDriver BiDi
+// RemoteValue specification, which is what Runtime.evaluate returns if deep
+// serialization is requested.
+type deepValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (v value) Err() error    { return v.err }
+func (v value) Bytes() []byte { return v.raw }
+func (v value) To(x interface{}) error {
+	if v.deep != nil && assignNative(x, v.deep.native()) {
+		return nil
+	}
+	return json.Unmarshal(v.raw, x)
+}
+func (v value) Float() (f float32)  { v.To(&f); return f }
+func (v value) Int() (i int)        { v.To(&i); return i }
+func (v value) String() (s string)  { v.To(&s); return s }
+func (v value) Bool() (b bool)      { v.To(&b); return b }
+func (v value) Time() (t time.Time) { v.To(&t); return t }
+func (v value) BigInt() *big.Int {
+	n := new(big.Int)
+	if v.To(n) != nil {
+		return nil
+	}
+	return n
+}
+func (v value) Undefined() bool {
+	if v.deep != nil {
+		return v.deep.Type == "undefined"
+	}
+	return v.err == nil && len(v.raw) == 0
+}
+func (v value) Interface() (x interface{}) {
+	if v.deep != nil {
+		return v.deep.native()
+	}
+	if len(v.raw) == 0 {
+		return nil
+	}
+	v.To(&x)
+	return x
+}
 func (v value) Array() (values []Value) {
+	if v.deep != nil && (v.deep.Type == "array" || v.deep.Type == "set") {
+		items := []*deepValue{}
+		json.Unmarshal(v.deep.Value, &items)
+		for _, item := range items {
+			values = append(values, item.value())
+		}
+		return values
+	}
 	array := []json.RawMessage{}
 	v.To(&array)
 	for _, el := range array {
@@ -38,6 +128,14 @@ func (v value) Array() (values []Value) {
 }
 func (v value) Object() (object map[string]Value) {
 	object = map[string]Value{}
+	if v.deep != nil && (v.deep.Type == "object" || v.deep.Type == "map") {
+		for _, kv := range v.deep.pairs() {
+			if k, ok := kv.key.(string); ok {
+				object[k] = kv.value.value()
+			}
+		}
+		return object
+	}
 	kv := map[string]json.RawMessage{}
 	v.To(&kv)
 	for k, v := range kv {
@@ -45,3 +143,258 @@ func (v value) Object() (object map[string]Value) {
 	}
 	return object
 }
+
+// assignNative stores a natively decoded value into the pointer x if it
+// points to a concrete type that can hold it, e.g. a float for NaN or
+// time.Time for Date. Otherwise, and always for interface{} targets, it
+// returns false and the caller should fall back to JSON decoding.
+func assignNative(x interface{}, native interface{}) bool {
+	if native == nil {
+		return false
+	}
+	p := reflect.ValueOf(x)
+	if p.Kind() != reflect.Ptr || p.IsNil() || p.Elem().Kind() == reflect.Interface {
+		return false
+	}
+	dst, src := p.Elem(), reflect.ValueOf(native)
+	switch n := native.(type) {
+	case float64:
+		if k := dst.Kind(); k == reflect.Float32 || k == reflect.Float64 {
+			dst.SetFloat(n)
+			return true
+		}
+	case *big.Int:
+		if dst.Type() == reflect.TypeOf(big.Int{}) {
+			dst.Set(src.Elem())
+			return true
+		}
+	case time.Time, Map, Set, RegExp, Undefined:
+		if src.Type() == dst.Type() {
+			dst.Set(src)
+			return true
+		}
+	}
+	return false
+}
+
+type deepPair struct {
+	key   interface{}
+	value *deepValue
+}
+
+// pairs returns key-value pairs of the serialized object or map. String keys
+// are returned as is, other keys are converted into their native Go values.
+func (d *deepValue) pairs() (pairs []deepPair) {
+	entries := [][2]json.RawMessage{}
+	json.Unmarshal(d.Value, &entries)
+	for _, e := range entries {
+		pair := deepPair{value: &deepValue{}}
+		if err := json.Unmarshal(e[1], pair.value); err != nil {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(e[0], &s); err == nil {
+			pair.key = s
+		} else {
+			key := &deepValue{}
+			json.Unmarshal(e[0], key)
+			pair.key = key.native()
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+func (d *deepValue) value() value {
+	return value{raw: d.json(), deep: d}
+}
+
+// native converts the serialized value into the closest Go type.
+func (d *deepValue) native() interface{} {
+	switch d.Type {
+	case "undefined":
+		return Undefined{}
+	case "string", "boolean":
+		var x interface{}
+		json.Unmarshal(d.Value, &x)
+		return x
+	case "number":
+		var s string
+		if err := json.Unmarshal(d.Value, &s); err != nil {
+			var f float64
+			json.Unmarshal(d.Value, &f)
+			return f
+		}
+		switch s {
+		case "NaN":
+			return math.NaN()
+		case "-0":
+			return math.Copysign(0, -1)
+		case "Infinity":
+			return math.Inf(1)
+		case "-Infinity":
+			return math.Inf(-1)
+		}
+	case "bigint":
+		var s string
+		json.Unmarshal(d.Value, &s)
+		if n, ok := new(big.Int).SetString(s, 10); ok {
+			return n
+		}
+	case "date":
+		var s string
+		json.Unmarshal(d.Value, &s)
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t
+		}
+	case "regexp":
+		re := RegExp{}
+		json.Unmarshal(d.Value, &re)
+		return re
+	case "array":
+		items := []*deepValue{}
+		json.Unmarshal(d.Value, &items)
+		array := []interface{}{}
+		for _, item := range items {
+			array = append(array, item.native())
+		}
+		return array
+	case "set":
+		items := []*deepValue{}
+		json.Unmarshal(d.Value, &items)
+		set := Set{}
+		for _, item := range items {
+			set = append(set, item.native())
+		}
+		return set
+	case "object":
+		object := map[string]interface{}{}
+		for _, kv := range d.pairs() {
+			if k, ok := kv.key.(string); ok {
+				object[k] = kv.value.native()
+			}
+		}
+		return object
+	case "map":
+		m := Map{}
+		for _, kv := range d.pairs() {
+			m = append(m, MapEntry{Key: kv.key, Value: kv.value.native()})
+		}
+		return m
+	}
+	if d.opaque() {
+		return map[string]interface{}{}
+	}
+	return nil
+}
+
+// opaque returns true for objects that can't be serialized, such as DOM nodes,
+// functions, errors or promises. Like without deep serialization, they are
+// converted into empty objects.
+func (d *deepValue) opaque() bool {
+	switch d.Type {
+	case "undefined", "null", "string", "boolean", "number", "bigint", "symbol":
+		return false
+	}
+	return true
+}
+
+// json converts the serialized value into JSON, similarly to JSON.stringify.
+// Values that can't be represented in JSON (undefined, NaN, Infinity, symbols)
+// result in nil, objects that can't be serialized (DOM nodes, functions etc)
+// result in an empty object. Map is converted to an object if all of its
+// keys are strings, or into an array of key-value pairs otherwise.
+func (d *deepValue) json() json.RawMessage {
+	switch d.Type {
+	case "null":
+		return json.RawMessage(`null`)
+	case "string", "boolean":
+		return d.Value
+	case "number":
+		if len(d.Value) > 0 && d.Value[0] != '"' {
+			return d.Value
+		} else if string(d.Value) == `"-0"` {
+			return json.RawMessage(`-0`)
+		}
+	case "bigint":
+		var s string
+		json.Unmarshal(d.Value, &s)
+		if _, ok := new(big.Int).SetString(s, 10); ok {
+			return json.RawMessage(s)
+		}
+	case "date":
+		return d.Value
+	case "regexp":
+		re := RegExp{}
+		json.Unmarshal(d.Value, &re)
+		b, _ := json.Marshal(re)
+		return b
+	case "array", "set":
+		items := []*deepValue{}
+		json.Unmarshal(d.Value, &items)
+		buf := bytes.NewBufferString("[")
+		for i, item := range items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if b := item.json(); b != nil {
+				buf.Write(b)
+			} else {
+				buf.WriteString("null")
+			}
+		}
+		buf.WriteByte(']')
+		return buf.Bytes()
+	case "object", "map":
+		pairs := d.pairs()
+		for _, kv := range pairs {
+			if _, ok := kv.key.(string); !ok {
+				return d.jsonEntries(pairs)
+			}
+		}
+		buf := bytes.NewBufferString("{")
+		for _, kv := range pairs {
+			b := kv.value.json()
+			if b == nil {
+				continue
+			}
+			if buf.Len() > 1 {
+				buf.WriteByte(',')
+			}
+			k, _ := json.Marshal(kv.key)
+			buf.Write(k)
+			buf.WriteByte(':')
+			buf.Write(b)
+		}
+		buf.WriteByte('}')
+		return buf.Bytes()
+	}
+	if d.opaque() {
+		return json.RawMessage(`{}`)
+	}
+	return nil
+}
+
+func (d *deepValue) jsonEntries(pairs []deepPair) json.RawMessage {
+	buf := bytes.NewBufferString("[")
+	for i, kv := range pairs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(kv.key)
+		if err != nil {
+			k = []byte("null")
+		}
+		v := kv.value.json()
+		if v == nil {
+			v = []byte("null")
+		}
+		buf.WriteByte('[')
+		buf.Write(k)
+		buf.WriteByte(',')
+		buf.Write(v)
+		buf.WriteByte(']')
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
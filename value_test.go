@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"math"
+	"math/big"
+	"reflect"
 	"testing"
+	"time"
 )
 
 var errTest = errors.New("fail")
@@ -65,3 +69,83 @@ func TestRawValue(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestDeepValue(t *testing.T) {
+	for _, test := range []struct {
+		Deep   string
+		JSON   string
+		Native interface{}
+	}{
+		{Deep: `{"type":"undefined"}`, JSON: ``, Native: Undefined{}},
+		{Deep: `{"type":"null"}`, JSON: `null`, Native: nil},
+		{Deep: `{"type":"string","value":"foo"}`, JSON: `"foo"`, Native: "foo"},
+		{Deep: `{"type":"number","value":42}`, JSON: `42`, Native: float64(42)},
+		{Deep: `{"type":"number","value":"Infinity"}`, JSON: ``, Native: math.Inf(1)},
+		{Deep: `{"type":"number","value":"-0"}`, JSON: `-0`, Native: math.Copysign(0, -1)},
+		{Deep: `{"type":"bigint","value":"12345678901234567890"}`, JSON: `12345678901234567890`},
+		{Deep: `{"type":"date","value":"2020-01-02T03:04:05.678Z"}`, JSON: `"2020-01-02T03:04:05.678Z"`,
+			Native: time.Date(2020, 1, 2, 3, 4, 5, 678000000, time.UTC)},
+		{Deep: `{"type":"array","value":[{"type":"number","value":1},{"type":"undefined"}]}`, JSON: `[1,null]`,
+			Native: []interface{}{float64(1), Undefined{}}},
+		{Deep: `{"type":"object","value":[["y",{"type":"number","value":1}],["x",{"type":"undefined"}],["a",{"type":"boolean","value":true}]]}`,
+			JSON: `{"y":1,"a":true}`, Native: map[string]interface{}{"y": float64(1), "x": Undefined{}, "a": true}},
+		{Deep: `{"type":"map","value":[["b",{"type":"number","value":1}],[{"type":"number","value":2},{"type":"string","value":"c"}]]}`,
+			JSON: `[["b",1],[2,"c"]]`, Native: Map{{Key: "b", Value: float64(1)}, {Key: float64(2), Value: "c"}}},
+		{Deep: `{"type":"set","value":[{"type":"string","value":"b"},{"type":"string","value":"a"}]}`,
+			JSON: `["b","a"]`, Native: Set{"b", "a"}},
+		{Deep: `{"type":"node","value":{"nodeType":1,"localName":"div","childNodeCount":0}}`,
+			JSON: `{}`, Native: map[string]interface{}{}},
+		{Deep: `{"type":"function"}`, JSON: `{}`, Native: map[string]interface{}{}},
+		{Deep: `{"type":"object","value":[["a",{"type":"number","value":1}],["f",{"type":"function"}],["p",{"type":"promise"}]]}`,
+			JSON: `{"a":1,"f":{},"p":{}}`, Native: map[string]interface{}{"a": float64(1), "f": map[string]interface{}{}, "p": map[string]interface{}{}}},
+		{Deep: `{"type":"symbol"}`, JSON: ``},
+	} {
+		d := &deepValue{}
+		if err := json.Unmarshal([]byte(test.Deep), d); err != nil {
+			t.Fatal(err)
+		}
+		v := d.value()
+		if string(v.Bytes()) != test.JSON {
+			t.Error(test.Deep, string(v.Bytes()), test.JSON)
+		}
+		if test.Native != nil && !reflect.DeepEqual(v.Interface(), test.Native) {
+			t.Error(test.Deep, v.Interface(), test.Native)
+		}
+	}
+}
+
+func TestDeepValueConversion(t *testing.T) {
+	nan := (&deepValue{Type: "number", Value: json.RawMessage(`"NaN"`)}).value()
+	if f := nan.Float(); !math.IsNaN(float64(f)) {
+		t.Fatal(f)
+	}
+	bigint := (&deepValue{Type: "bigint", Value: json.RawMessage(`"12345678901234567890"`)}).value()
+	if n := bigint.BigInt(); n == nil || n.String() != "12345678901234567890" {
+		t.Fatal(n)
+	}
+	var n big.Int
+	if err := bigint.To(&n); err != nil || n.String() != "12345678901234567890" {
+		t.Fatal(n, err)
+	}
+	date := (&deepValue{Type: "date", Value: json.RawMessage(`"2020-01-02T03:04:05Z"`)}).value()
+	if d := date.Time(); !d.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatal(d)
+	}
+	undefined := (&deepValue{Type: "undefined"}).value()
+	if !undefined.Undefined() || date.Undefined() {
+		t.Fatal(undefined)
+	}
+	array := (&deepValue{Type: "array", Value: json.RawMessage(`[{"type":"bigint","value":"1"},{"type":"date","value":"2020-01-02T03:04:05Z"}]`)}).value()
+	if a := array.Array(); len(a) != 2 || a[0].(NativeValue).BigInt().Int64() != 1 || a[1].(NativeValue).Time().Year() != 2020 {
+		t.Fatal(a)
+	}
+	// Values decoded into interface{} are the same as without deep serialization
+	var x interface{}
+	if err := date.To(&x); err != nil || x != "2020-01-02T03:04:05Z" {
+		t.Fatal(x, err)
+	}
+	object := (&deepValue{Type: "object", Value: json.RawMessage(`[["x",{"type":"number","value":"NaN"}]]`)}).value()
+	if x := object.Object()["x"].Float(); !math.IsNaN(float64(x)) {
+		t.Fatal(x)
+	}
+}
@@ -0,0 +1,176 @@
+package lorca
+
+import (
+	"time"
+)
+
+// WindowEventType defines the type of a window event.
+type WindowEventType string
+
+const (
+	// WindowMoved is emitted when the window position changes
+	WindowMoved WindowEventType = "moved"
+	// WindowResized is emitted when the window size changes
+	WindowResized WindowEventType = "resized"
+	// WindowStateChanged is emitted when the window is maximized, minimized,
+	// restored or made fullscreen
+	WindowStateChanged WindowEventType = "stateChanged"
+	// WindowFocused is emitted when the page gets input focus
+	WindowFocused WindowEventType = "focus"
+	// WindowBlurred is emitted when the page loses input focus
+	WindowBlurred WindowEventType = "blur"
+	// WindowShown is emitted when the page becomes visible
+	WindowShown WindowEventType = "visible"
+	// WindowHidden is emitted when the page becomes hidden, e.g. the window is
+	// minimized or covered
+	WindowHidden WindowEventType = "hidden"
+)
+
+// WindowEvent is a change of the window geometry, state, visibility or focus.
+// Bounds are the most recent window bounds known.
+type WindowEvent struct {
+	Type   WindowEventType
+	Bounds Bounds
+}
+
+// windowPollInterval is how often window bounds are checked for changes, as
+// there are no CDP events for that.
+var windowPollInterval = 250 * time.Millisecond
+
+// reservedWorldPrefix starts the names of the isolated worlds used by lorca
+// itself, UI.IsolatedWorld doesn't accept them.
+const reservedWorldPrefix = "__lorca"
+
+// windowEventWorld is the isolated world that reports page visibility and
+// focus, so that page scripts can't interfere with it.
+const windowEventWorld = reservedWorldPrefix + "WindowEvents"
+
+// Page visibility and focus are reported by a binding in the isolated world.
+const windowEventScript = `(() => {
+	const send = type => window.__lorcaWindowEvent(type);
+	document.addEventListener('visibilitychange', () => send(document.visibilityState));
+	window.addEventListener('focus', () => send('focus'));
+	window.addEventListener('blur', () => send('blur'));
+})()`
+
+func (c *chrome) onWindowEvent(f func(WindowEvent)) error {
+	// Calls are serialized, so that the setup is done once, but retried if
+	// it fails
+	c.windowEventMu.Lock()
+	defer c.windowEventMu.Unlock()
+	c.Lock()
+	ready := c.windowEvent != nil
+	if ready {
+		c.windowEvent = append(c.windowEvent, f)
+	}
+	c.Unlock()
+	if ready {
+		return nil
+	}
+
+	var last Bounds
+	if !c.headless {
+		var err error
+		if last, err = c.bounds(); err != nil {
+			return err
+		}
+	}
+	w, err := c.isolatedWorld(windowEventWorld)
+	if err != nil {
+		return err
+	}
+	if err := w.Bind("__lorcaWindowEvent", func(t WindowEventType) {
+		c.Lock()
+		b := c.lastBounds
+		c.Unlock()
+		c.emitWindowEvent(t, b)
+	}); err != nil {
+		return err
+	}
+	if !c.windowEventScript {
+		if err := w.addScript(windowEventScript); err != nil {
+			return err
+		}
+		c.windowEventScript = true
+	}
+	if err := w.eval(windowEventScript).Err(); err != nil {
+		return err
+	}
+	c.Lock()
+	c.windowEvent = append(c.windowEvent, f)
+	c.Unlock()
+
+	// The first subscription starts the bounds poller shared by all of them
+	if !c.headless {
+		c.Lock()
+		c.lastBounds = last
+		c.Unlock()
+		go c.pollBounds(last)
+	}
+	return nil
+}
+
+func (c *chrome) emitWindowEvent(t WindowEventType, b Bounds) {
+	c.Lock()
+	handlers := c.windowEvent
+	c.Unlock()
+	for _, f := range handlers {
+		f(WindowEvent{Type: t, Bounds: b})
+	}
+}
+
+// pollBounds emits window events for the changes of the window bounds until
+// the UI is done.
+func (c *chrome) pollBounds(last Bounds) {
+	t := time.NewTicker(windowPollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+		}
+		b, err := c.bounds()
+		if err != nil {
+			// The browser might be restarting after a crash
+			continue
+		}
+		c.Lock()
+		c.lastBounds = b
+		c.Unlock()
+		if b.WindowState != last.WindowState {
+			c.emitWindowEvent(WindowStateChanged, b)
+		}
+		// Position and size are only meaningful in the normal state
+		if b.WindowState == WindowStateNormal && last.WindowState == WindowStateNormal {
+			if b.Left != last.Left || b.Top != last.Top {
+				c.emitWindowEvent(WindowMoved, b)
+			}
+			if b.Width != last.Width || b.Height != last.Height {
+				c.emitWindowEvent(WindowResized, b)
+			}
+		}
+		last = b
+	}
+}
+
+// focus restores the window if it's minimized and brings it to front.
+func (c *chrome) focus() error {
+	if !c.headless {
+		b, err := c.bounds()
+		if err != nil {
+			return err
+		}
+		if b.WindowState == WindowStateMinimized {
+			if err := c.setWindowState(WindowStateNormal); err != nil {
+				return err
+			}
+		}
+	}
+	return c.bringToFront()
+}
+
+func (c *chrome) bringToFront() error {
+	_, err := c.send("Page.bringToFront", nil)
+	return err
+}
@@ -0,0 +1,70 @@
+package lorca
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWindowEvents(t *testing.T) {
+	ui, err := New("", "", 480, 320, "--headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+
+	events := make(chan WindowEvent, 10)
+	if err := ui.OnWindowEvent(func(e WindowEvent) { events <- e }); err != nil {
+		t.Fatal(err)
+	}
+	ui.Eval(`window.dispatchEvent(new Event('blur')), window.dispatchEvent(new Event('focus'))`)
+	if e := <-events; e.Type != WindowBlurred {
+		t.Fatal(e)
+	}
+	if e := <-events; e.Type != WindowFocused {
+		t.Fatal(e)
+	}
+	if err := ui.Focus(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWindowEventRetry(t *testing.T) {
+	// The first setup fails, the second one must not be skipped
+	var worlds int32
+	record(t, func(method string) bool {
+		return method == "Page.createIsolatedWorld" && atomic.AddInt32(&worlds, 1) == 1
+	}, func(c *chrome) {
+		if err := c.onWindowEvent(func(WindowEvent) {}); err == nil {
+			t.Fatal("setup did not fail")
+		}
+		if err := c.onWindowEvent(func(WindowEvent) {}); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(c.windowEvent); n != 1 {
+			t.Fatal(n)
+		}
+	})
+}
+
+func TestWindowEventWorldReserved(t *testing.T) {
+	u := &ui{chrome: newChromeState(Options{})}
+	if _, err := u.IsolatedWorld(windowEventWorld); err == nil {
+		t.Fatal("reserved world name accepted")
+	}
+}
+
+func TestPollBoundsDone(t *testing.T) {
+	c := newChromeState(Options{})
+	close(c.done)
+	stopped := make(chan struct{})
+	go func() {
+		c.pollBounds(Bounds{})
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("poller not stopped")
+	}
+}
@@ -0,0 +1,211 @@
+package lorca
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// World is an isolated JS world of the page. It shares the DOM with the page,
+// but not the JS globals, so page scripts can't interfere with the code
+// evaluated in it or with the functions bound to it. World is re-created
+// automatically after each navigation, bindings are preserved.
+type World interface {
+	Eval(js string) Value
+	Call(fn string, args ...interface{}) Value
+	Bind(name string, f interface{}) error
+}
+
+type world struct {
+	chrome   *chrome
+	name     string
+	context  int
+	bindings map[string]bindingFunc
+	scripts  []string
+}
+
+type executionContext struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	AuxData struct {
+		FrameID string `json:"frameId"`
+	} `json:"auxData"`
+}
+
+// isolatedWorld returns an isolated world with the given name, creating it if
+// necessary.
+func (c *chrome) isolatedWorld(name string) (*world, error) {
+	if name == "" {
+		return nil, errors.New("world name must not be empty")
+	}
+	c.Lock()
+	w, ok := c.worlds[name]
+	if !ok {
+		w = &world{chrome: c, name: name, bindings: map[string]bindingFunc{}}
+		c.worlds[name] = w
+	}
+	c.Unlock()
+	if ok {
+		return w, nil
+	}
+
+	// An empty script makes Chrome create the world for every new document
+	err := w.addScript("")
+	if err == nil {
+		_, err = w.contextID()
+	}
+	if err != nil {
+		// Forget the broken world, so that the next call creates it again
+		c.Lock()
+		delete(c.worlds, name)
+		c.Unlock()
+		return nil, err
+	}
+	// Handlers are registered only for a world that has been created, as
+	// there's no way to remove them
+	c.on("Runtime.executionContextCreated", func(params json.RawMessage) {
+		ev := struct {
+			Context executionContext `json:"context"`
+		}{}
+		json.Unmarshal(params, &ev)
+		// Main frame ID is the same as the page target ID
+		if ev.Context.Name == name && ev.Context.AuxData.FrameID == c.targetID() {
+			c.Lock()
+			if c.worlds[name] == w {
+				w.context = ev.Context.ID
+			}
+			c.Unlock()
+		}
+	})
+	c.on("Runtime.executionContextDestroyed", func(params json.RawMessage) {
+		ev := struct {
+			ID int `json:"executionContextId"`
+		}{}
+		json.Unmarshal(params, &ev)
+		c.Lock()
+		if w.context == ev.ID {
+			w.context = 0
+		}
+		c.Unlock()
+	})
+	c.on("Runtime.executionContextsCleared", func(json.RawMessage) {
+		c.Lock()
+		w.context = 0
+		c.Unlock()
+	})
+	return w, nil
+}
+
+// contextID returns the execution context of the world in the current
+// document, creating the world if it doesn't exist yet.
+func (w *world) contextID() (int, error) {
+	c := w.chrome
+	c.Lock()
+	id := w.context
+	c.Unlock()
+	if id != 0 {
+		return id, nil
+	}
+	res, err := c.send("Page.createIsolatedWorld", h{"frameId": c.targetID(), "worldName": w.name})
+	if err != nil {
+		return 0, err
+	}
+	ctx := struct {
+		ID int `json:"executionContextId"`
+	}{}
+	if err := json.Unmarshal(res, &ctx); err != nil {
+		return 0, err
+	}
+	c.Lock()
+	w.context = ctx.ID
+	c.Unlock()
+	return ctx.ID, nil
+}
+
+func (w *world) eval(expr string) value {
+	id, err := w.contextID()
+	if err != nil {
+		return value{err: err}
+	}
+	return w.chrome.evaluate(h{"expression": expr, "awaitPromise": true, "contextId": id})
+}
+
+func (w *world) Eval(js string) Value { return w.eval(js) }
+
+func (w *world) Call(fn string, args ...interface{}) Value {
+	js, err := callExpr(fn, args)
+	if err != nil {
+		return value{err: err}
+	}
+	return w.eval(js)
+}
+
+func (w *world) Bind(name string, f interface{}) error {
+	binding, err := newBinding(f)
+	if err != nil {
+		return err
+	}
+	c := w.chrome
+	c.Lock()
+	_, exists := w.bindings[name]
+	w.bindings[name] = binding
+	c.Unlock()
+	if exists {
+		return nil
+	}
+
+	script := bindingScript(name)
+	if _, err := c.send("Runtime.addBinding", h{"name": name, "executionContextName": w.name}); err != nil {
+		w.unbind(name)
+		return err
+	}
+	if err := w.addScript(script); err != nil {
+		w.unbind(name)
+		return err
+	}
+	return w.eval(script).Err()
+}
+
+// unbind forgets the binding that failed to be added, so that it can be added
+// again.
+func (w *world) unbind(name string) {
+	w.chrome.Lock()
+	delete(w.bindings, name)
+	w.chrome.Unlock()
+}
+
+// addScript evaluates the source in the world of every new document.
+func (w *world) addScript(source string) error {
+	c := w.chrome
+	if _, err := c.send("Page.addScriptToEvaluateOnNewDocument", h{"source": source, "worldName": w.name}); err != nil {
+		return err
+	}
+	c.Lock()
+	w.scripts = append(w.scripts, source)
+	c.Unlock()
+	return nil
+}
+
+// restore adds the world bindings and scripts again after the browser has
+// been restarted.
+func (w *world) restore() error {
+	c := w.chrome
+	c.Lock()
+	w.context = 0
+	bindings := []string{}
+	for name := range w.bindings {
+		bindings = append(bindings, name)
+	}
+	scripts := append([]string{}, w.scripts...)
+	c.Unlock()
+	for _, name := range bindings {
+		if _, err := c.send("Runtime.addBinding", h{"name": name, "executionContextName": w.name}); err != nil {
+			return err
+		}
+	}
+	for _, source := range scripts {
+		if _, err := c.send("Page.addScriptToEvaluateOnNewDocument", h{"source": source, "worldName": w.name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}